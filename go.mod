@@ -3,13 +3,13 @@ module github.com/gjbae1212/cloud-instance-dns
 go 1.14
 
 require (
-	github.com/aws/aws-sdk-go v1.19.49
+	github.com/aws/aws-sdk-go v1.25.0
 	github.com/gjbae1212/go-module v0.4.8
 	github.com/logrusorgru/aurora v0.0.0-20190428105938-cea283e61946
-	github.com/miekg/dns v1.1.14
-	github.com/stretchr/testify v1.3.0
-	golang.org/x/net v0.0.0-20190611141213-3f473d35a33a // indirect
-	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
-	google.golang.org/api v0.6.0
+	github.com/miekg/dns v1.1.43
+	github.com/stretchr/testify v1.6.1
+	golang.org/x/net v0.0.0-20210503060351-7fd8e65b6420
+	golang.org/x/oauth2 v0.0.0-20210628180205-a41e5a781914
+	google.golang.org/api v0.50.0
 	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"path"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	defaultAwsDiscoveryRegion   = "us-east-1"
+	defaultAwsDiscoveryInterval = 1 * time.Hour
+)
+
+// awsRegionDiscovery finds enabled regions using DescribeRegions.
+type awsRegionDiscovery struct {
+	region    string   // region calling DescribeRegions
+	include   []string // glob patterns(ex: ap-*), empty is matched to every regions
+	exclude   []string // glob patterns
+	interval  time.Duration
+	checkedAt time.Time
+}
+
+func newAwsRegionDiscovery(include, exclude []string) *awsRegionDiscovery {
+	return &awsRegionDiscovery{
+		region:   defaultAwsDiscoveryRegion,
+		include:  include,
+		exclude:  exclude,
+		interval: defaultAwsDiscoveryInterval,
+	}
+}
+
+func (d *awsRegionDiscovery) match(region string) bool {
+	for _, pattern := range d.exclude {
+		if ok, _ := path.Match(pattern, region); ok {
+			return false
+		}
+	}
+	if len(d.include) == 0 {
+		return true
+	}
+	for _, pattern := range d.include {
+		if ok, _ := path.Match(pattern, region); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// regionClients returns clients per region, discovering regions again when a discovery interval is passed.
+func (c *awsAccount) regionClients(ctx context.Context) (map[string]*ec2.EC2, error) {
+	c.RLock()
+	due := c.discovery != nil && time.Since(c.discovery.checkedAt) >= c.discovery.interval
+	c.RUnlock()
+	if due {
+		if err := c.discoverRegions(ctx); err != nil {
+			c.RLock()
+			empty := len(c.clients) == 0
+			c.RUnlock()
+			// a first discovery must be success, after that previous regions are kept.
+			if empty {
+				return nil, err
+			}
+			log.Printf("[err] aws region discovery(%s) %+v\n", c.alias, err)
+		}
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+	clients := make(map[string]*ec2.EC2, len(c.clients))
+	for region, client := range c.clients {
+		clients[region] = client
+	}
+	return clients, nil
+}
+
+// discoverRegions adds clients of enabled regions and drops clients of disappeared regions.
+func (c *awsAccount) discoverRegions(ctx context.Context) error {
+	client, err := c.newClient(c.discovery.region)
+	if err != nil {
+		return err
+	}
+	output, err := client.DescribeRegionsWithContext(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool)
+	for _, r := range output.Regions {
+		if region := aws.StringValue(r.RegionName); region != "" && c.discovery.match(region) {
+			found[region] = true
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for region := range c.clients {
+		if !found[region] {
+			delete(c.clients, region)
+			log.Printf("%s aws region %s\n", aurora.Red("[drop]"), aurora.Magenta(region))
+		}
+	}
+	for region := range found {
+		if _, ok := c.clients[region]; ok {
+			continue
+		}
+		regionClient, err := c.newClient(region)
+		if err != nil {
+			return err
+		}
+		c.clients[region] = regionClient
+		log.Printf("%s aws region %s\n", aurora.Green("[add]"), aurora.Magenta(region))
+	}
+	c.discovery.checkedAt = time.Now()
+	return nil
+}
+
+type awsProvider struct {
+	conf *AwsConfig
+}
+
+// NewAwsProvider returns a provider looking up running ec2 instances.
+func NewAwsProvider(conf *AwsConfig) InstanceProvider {
+	return &awsProvider{conf: conf}
+}
+
+func (p *awsProvider) Name() string {
+	return string(AWS)
+}
+
+func (p *awsProvider) Schedule() (time.Duration, time.Duration) {
+	return p.conf.refreshInterval, p.conf.ttl
+}
+
+func (p *awsProvider) Sources(ctx context.Context) ([]Source, error) {
+	var sources []Source
+	for _, account := range p.conf.accounts {
+		// a failed account doesn't fail other accounts
+		clients, err := account.regionClients(ctx)
+		if err != nil {
+			log.Printf("[err] aws account(%s) %+v\n", account.alias, err)
+			sources = append(sources, &failedSource{name: account.alias, err: err})
+			continue
+		}
+		for region, client := range clients {
+			sources = append(sources, &awsSource{account: account.alias, region: region, client: client,
+				pageSize: p.conf.pageSize, naming: &p.conf.naming})
+		}
+	}
+	return sources, nil
+}
+
+// awsSource is a region of an account.
+type awsSource struct {
+	account  string
+	region   string
+	client   *ec2.EC2
+	pageSize int64
+	naming   *naming
+}
+
+func (s *awsSource) Name() string {
+	if s.account == "" {
+		return s.region
+	}
+	return s.account + "/" + s.region
+}
+
+func (s *awsSource) Fetch(ctx context.Context) ([]*Entry, error) {
+	// get running instances
+	input := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-state-name"), Values: []*string{aws.String("running")}},
+		},
+	}
+	if s.pageSize > 0 {
+		input.MaxResults = aws.Int64(s.pageSize)
+	}
+
+	var entries []*Entry
+	// follow NextToken until a last page
+	err := s.client.DescribeInstancesPagesWithContext(ctx, input, func(output *ec2.DescribeInstancesOutput, last bool) bool {
+		for _, rv := range output.Reservations {
+			for _, inst := range rv.Instances {
+				entries = append(entries, awsEntry(s.account, s.region, s.naming, inst))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func awsEntry(account, region string, naming *naming, inst *ec2.Instance) *Entry {
+	record := &Record{Vendor: AWS, ZoneOrRegion: region, Account: account, ID: aws.StringValue(inst.InstanceId),
+		InstanceType: aws.StringValue(inst.InstanceType), LaunchTime: aws.TimeValue(inst.LaunchTime)}
+
+	// insert public ip
+	if inst.PublicIpAddress != nil {
+		if value := net.ParseIP(*inst.PublicIpAddress); value != nil {
+			record.PublicIP = value
+		}
+	}
+
+	// insert private ip
+	if inst.PrivateIpAddress != nil {
+		if value := net.ParseIP(*inst.PrivateIpAddress); value != nil {
+			record.PrivateIP = value
+		}
+	}
+
+	// insert hostnames of ec2, a public hostname resolves to a private ip inside a vpc.
+	record.PublicDNS = aws.StringValue(inst.PublicDnsName)
+	record.PrivateDNS = aws.StringValue(inst.PrivateDnsName)
+
+	// insert ipv6 of a primary network interface, ipv6 of ec2 is global so it is public and private.
+	// a record has one address per family, so only a first address of a primary network interface is kept.
+	for _, ni := range inst.NetworkInterfaces {
+		if ni.Attachment != nil && aws.Int64Value(ni.Attachment.DeviceIndex) != 0 {
+			continue
+		}
+		for _, addr := range ni.Ipv6Addresses {
+			if value := net.ParseIP(aws.StringValue(addr.Ipv6Address)); value != nil {
+				record.PublicIPv6 = value
+				record.PrivateIPv6 = value
+				break
+			}
+		}
+	}
+
+	// insert name and tags
+	if len(inst.Tags) > 0 {
+		record.Tags = make(map[string]string, len(inst.Tags))
+		for _, tag := range inst.Tags {
+			if aws.StringValue(tag.Key) == "Name" {
+				record.Name = aws.StringValue(tag.Value)
+			}
+			record.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+
+	// insert services from tags(ex: dns-srv: _http._tcp:8080)
+	record.Services = parseServices(record.Tags)
+
+	// register instance-id, name, names from templates and tags(ex: web.role.tag)
+	entry := &Entry{Record: record, Names: []string{record.ID}}
+	naming.register(entry)
+
+	// register names scoped to an account(ex: web.prod)
+	if account != "" {
+		for _, name := range entry.Names {
+			entry.add(name+"."+account, entry.origin(name)+"."+account)
+		}
+	}
+	return entry
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type fakeEC2Instance struct {
+	id        string
+	name      string
+	publicIP  string
+	privateIP string
+	tags      map[string]string
+	ipv6      string
+}
+
+// fakeEC2 is a ec2 endpoint serving DescribeInstances split into pages.
+type fakeEC2 struct {
+	sync.Mutex
+	pages   [][]fakeEC2Instance
+	regions []string
+	forms   []map[string][]string
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.forms = append(f.forms, r.PostForm)
+
+	if r.PostForm.Get("Action") == "DescribeRegions" {
+		var body strings.Builder
+		body.WriteString(`<DescribeRegionsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>fake</requestId><regionInfo>`)
+		for _, region := range f.regions {
+			body.WriteString(fmt.Sprintf(`<item><regionName>%s</regionName><regionEndpoint>ec2.%s.amazonaws.com</regionEndpoint></item>`, region, region))
+		}
+		body.WriteString(`</regionInfo></DescribeRegionsResponse>`)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(body.String()))
+		return
+	}
+
+	page := 0
+	if token := r.PostForm.Get("NextToken"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n >= len(f.pages) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+
+	var body strings.Builder
+	body.WriteString(`<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>fake</requestId><reservationSet>`)
+	if len(f.pages) > 0 {
+		body.WriteString(`<item><reservationId>r-fake</reservationId><instancesSet>`)
+		for _, inst := range f.pages[page] {
+			var tags strings.Builder
+			for key, value := range inst.tags {
+				tags.WriteString(fmt.Sprintf(`<item><key>%s</key><value>%s</value></item>`, key, value))
+			}
+			var nis string
+			if inst.ipv6 != "" {
+				nis = fmt.Sprintf(`<networkInterfaceSet><item><attachment><deviceIndex>1</deviceIndex></attachment><ipv6AddressesSet><item><ipv6Address>2001:db8::ffff</ipv6Address></item></ipv6AddressesSet></item>`+
+					`<item><attachment><deviceIndex>0</deviceIndex></attachment><ipv6AddressesSet><item><ipv6Address>%s</ipv6Address></item></ipv6AddressesSet></item></networkInterfaceSet>`, inst.ipv6)
+			}
+			body.WriteString(fmt.Sprintf(`<item><instanceId>%s</instanceId><instanceType>t3.micro</instanceType><launchTime>2020-01-02T03:04:05.000Z</launchTime><privateDnsName>%s.ec2.internal</privateDnsName><dnsName>%s.compute.amazonaws.com</dnsName><privateIpAddress>%s</privateIpAddress><ipAddress>%s</ipAddress><tagSet><item><key>Name</key><value>%s</value></item>%s</tagSet>%s</item>`,
+				inst.id, inst.id, inst.id, inst.privateIP, inst.publicIP, inst.name, tags.String(), nis))
+		}
+		body.WriteString(`</instancesSet></item>`)
+	}
+	body.WriteString(`</reservationSet>`)
+	if page+1 < len(f.pages) {
+		body.WriteString(fmt.Sprintf(`<nextToken>%d</nextToken>`, page+1))
+	}
+	body.WriteString(`</DescribeInstancesResponse>`)
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(body.String()))
+}
+
+func newFakeEC2Client(t *testing.T, endpoint string) *ec2.EC2 {
+	client, err := newFakeEC2RegionClient(endpoint, "fake-region-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func newFakeEC2RegionClient(endpoint, region string) (*ec2.EC2, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("fake", "fake", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ec2.New(sess), nil
+}
+
+func TestAwsProvider_Fetch(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeEC2{pages: [][]fakeEC2Instance{
+		{
+			{id: "i-1", name: "web", publicIP: "1.1.1.1", privateIP: "10.0.0.1", tags: map[string]string{"Role": "Frontend", "env": "prod"}},
+			{id: "i-2", name: "web", publicIP: "1.1.1.2", privateIP: "10.0.0.2", tags: map[string]string{"Role": "frontend"}},
+		},
+		{
+			{id: "i-3", name: "db", publicIP: "1.1.1.3", privateIP: "10.0.0.3", ipv6: "2001:db8::3"},
+		},
+		{
+			{id: "i-4", name: "Batch", publicIP: "1.1.1.4", privateIP: "10.0.0.4"},
+		},
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	provider := NewAwsProvider(&AwsConfig{
+		accounts: []*awsAccount{
+			{clients: map[string]*ec2.EC2{"fake-region-1": newFakeEC2Client(t, ts.URL)}},
+		},
+		pageSize: 2,
+		naming:   naming{indexTags: []string{"role", "service"}},
+	})
+	entries, err := fetchAll(provider)
+	assert.NoError(err)
+	assert.Len(entries, 4)
+
+	// every pages must be requested with same page size
+	assert.Len(fake.forms, 3)
+	for i, form := range fake.forms {
+		assert.Equal("DescribeInstances", form["Action"][0])
+		assert.Equal("2", form["MaxResults"][0])
+		if i == 0 {
+			assert.Empty(form["NextToken"])
+		} else {
+			assert.Equal(strconv.Itoa(i), form["NextToken"][0])
+		}
+	}
+
+	table := merge(entries)
+	assert.Len(table["web"], 2)
+	assert.Len(table["db"], 1)
+	assert.Len(table["batch"], 1)
+	assert.Len(table["i-4"], 1)
+	assert.Equal("1.1.1.4", table["i-4"][0].PublicIP.String())
+	assert.Equal("10.0.0.4", table["i-4"][0].PrivateIP.String())
+	assert.Equal("fake-region-1", table["i-4"][0].ZoneOrRegion)
+	assert.Equal(AWS, table["i-4"][0].Vendor)
+
+	// metadata
+	assert.Equal("i-4", table["i-4"][0].ID)
+	assert.Equal("Batch", table["i-4"][0].Name)
+	assert.Equal("t3.micro", table["i-4"][0].InstanceType)
+	assert.Equal("2020-01-02T03:04:05Z", table["i-4"][0].LaunchTime.Format(time.RFC3339))
+
+	// hostnames of ec2
+	assert.Equal("i-4.compute.amazonaws.com", table["i-4"][0].PublicDNS)
+	assert.Equal("i-4.ec2.internal", table["i-4"][0].PrivateDNS)
+
+	// ipv6 of a primary network interface
+	assert.Equal("2001:db8::3", table["i-3"][0].PublicIPv6.String())
+	assert.Equal("2001:db8::3", table["i-3"][0].PrivateIPv6.String())
+	assert.Nil(table["i-4"][0].PublicIPv6)
+
+	// tags are indexed under configured keys
+	assert.Len(table["frontend.role.tag"], 2)
+	assert.Len(table["prod.env.tag"], 0)
+	assert.Equal("Frontend", table["i-1"][0].Tags["Role"])
+	assert.Equal("prod", table["i-1"][0].Tags["env"])
+
+	// names scoped to an account are registered
+	provider = NewAwsProvider(&AwsConfig{
+		accounts: []*awsAccount{
+			{alias: "prod", clients: map[string]*ec2.EC2{"fake-region-1": newFakeEC2Client(t, ts.URL)}},
+		},
+	})
+	sources, err := provider.Sources(context.Background())
+	assert.NoError(err)
+	assert.Len(sources, 1)
+	assert.Equal("prod/fake-region-1", sources[0].Name())
+	entries, err = fetchAll(provider)
+	assert.NoError(err)
+	table = merge(entries)
+	assert.Len(table["web"], 2)
+	assert.Len(table["web.prod"], 2)
+	assert.Len(table["i-4.prod"], 1)
+	assert.Equal("prod", table["i-4.prod"][0].Account)
+
+	// a failed page must fail a fetch
+	ts.Close()
+	_, err = fetchAll(provider)
+	assert.Error(err)
+}
+
+func TestAwsProvider_Sources(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeEC2{pages: [][]fakeEC2Instance{{{id: "i-1", name: "web", publicIP: "1.1.1.1", privateIP: "10.0.0.1"}}}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	// a account failed to discover regions doesn't fail other accounts
+	provider := NewAwsProvider(&AwsConfig{accounts: []*awsAccount{
+		{alias: "prod", clients: map[string]*ec2.EC2{"fake-region-1": newFakeEC2Client(t, ts.URL)}},
+		{alias: "dev", clients: make(map[string]*ec2.EC2), discovery: newAwsRegionDiscovery(nil, nil),
+			newClient: func(region string) (*ec2.EC2, error) {
+				return newFakeEC2RegionClient(down.URL, region)
+			}},
+	}})
+	sources, err := provider.Sources(context.Background())
+	assert.NoError(err)
+	assert.Len(sources, 2)
+
+	store, err := NewStore(nil, provider)
+	assert.NoError(err)
+	records, err := store.Lookup("web.prod")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	statuses := store.Status()
+	assert.Len(statuses, 2)
+	assert.Equal("AWS/dev", statuses[0].Name)
+	assert.True(statuses[0].Stale)
+	assert.Equal("AWS/prod/fake-region-1", statuses[1].Name)
+	assert.False(statuses[1].Stale)
+}
+
+func TestAwsRegionDiscovery_match(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]struct {
+		include []string
+		exclude []string
+		region  string
+		match   bool
+	}{
+		"all":            {region: "ap-northeast-2", match: true},
+		"include":        {include: []string{"ap-*"}, region: "ap-northeast-2", match: true},
+		"notInclude":     {include: []string{"ap-*"}, region: "us-east-1", match: false},
+		"exclude":        {exclude: []string{"us-*"}, region: "us-east-1", match: false},
+		"notExclude":     {exclude: []string{"us-*"}, region: "eu-west-1", match: true},
+		"includeExclude": {include: []string{"ap-*"}, exclude: []string{"ap-south-*"}, region: "ap-south-1", match: false},
+	}
+
+	for _, t := range tests {
+		assert.Equal(t.match, newAwsRegionDiscovery(t.include, t.exclude).match(t.region))
+	}
+}
+
+func TestAwsAccount_regionClients(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeEC2{regions: []string{"ap-northeast-1", "ap-northeast-2", "us-east-1"}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	conf := &awsAccount{
+		clients:   make(map[string]*ec2.EC2),
+		discovery: newAwsRegionDiscovery([]string{"ap-*", "us-*"}, []string{"us-*"}),
+		newClient: func(region string) (*ec2.EC2, error) {
+			return newFakeEC2RegionClient(ts.URL, region)
+		},
+	}
+
+	clients, err := conf.regionClients(context.Background())
+	assert.NoError(err)
+	assert.Len(clients, 2)
+	assert.Contains(clients, "ap-northeast-1")
+	assert.Contains(clients, "ap-northeast-2")
+
+	// a region is not checked again until a interval is passed.
+	fake.regions = []string{"ap-northeast-2", "ap-southeast-1"}
+	clients, err = conf.regionClients(context.Background())
+	assert.NoError(err)
+	assert.Len(clients, 2)
+	assert.Contains(clients, "ap-northeast-1")
+
+	// regions are added and dropped
+	conf.discovery.interval = 0
+	clients, err = conf.regionClients(context.Background())
+	assert.NoError(err)
+	assert.Len(clients, 2)
+	assert.Contains(clients, "ap-northeast-2")
+	assert.Contains(clients, "ap-southeast-1")
+
+	// previous regions are kept when discovery is failed.
+	ts.Close()
+	clients, err = conf.regionClients(context.Background())
+	assert.NoError(err)
+	assert.Len(clients, 2)
+
+	// a first discovery must be success
+	_, err = (&awsAccount{
+		clients:   make(map[string]*ec2.EC2),
+		discovery: newAwsRegionDiscovery(nil, nil),
+		newClient: conf.newClient,
+	}).regionClients(context.Background())
+	assert.Error(err)
+}
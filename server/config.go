@@ -3,44 +3,140 @@ package server
 import (
 	"context"
 	"fmt"
+	"net"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/miekg/dns"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	compute "google.golang.org/api/compute/v1"
 )
 
 const (
-	defaultPort       = "53"
-	defaultRName      = "gjbae1212.gmail.com."
-	defaultNameServer = "localhost."
+	defaultPort        = "53"
+	defaultRName       = "gjbae1212.gmail.com."
+	defaultNameServer  = "localhost."
+	defaultAwsPageSize = 1000
+	defaultConcurrency = 8
+	defaultTimeout     = 30 * time.Second
+
+	defaultRefreshInterval = 1 * time.Minute
+	defaultMinTTL          = 5 * time.Second
+	defaultSoaRefresh      = 6 * time.Hour
+	defaultSoaRetry        = 30 * time.Minute
+	defaultSoaExpire       = 24 * time.Hour
+	defaultSoaMinimum      = 2 * time.Minute
+	defaultStaleMaxAge     = 24 * time.Hour
+
+	awsAllRegions       = "all"
+	defaultAwsStsRegion = "us-east-1"
+
+	awsCredentialStatic  = "static"
+	awsCredentialDefault = "default"
+
+	nameTemplateAppend  = "append"  // generated names are added to a raw name
+	nameTemplateReplace = "replace" // generated names are used instead of a raw name
+
+	staleActionDrop     = "drop"     // records stale longer than a max age are not answered
+	staleActionServfail = "servfail" // SERVFAIL is answered when every records are stale longer than a max age
 )
 
 type CommonConfig struct {
+	zoneConfig // a primary zone, also answering PTR of reverse zones
+
+	port    string
+	listens []string      // addresses listened on, empty means every addresses
+	zones   []*zoneConfig // zones other than a primary zone
+	views   []*viewConfig // views choosing private or public ips by clients, a first matched view is used
+
+	concurrency int           // max sources fetched at once
+	timeout     time.Duration // deadline of fetching a source
+
+	refreshInterval time.Duration // interval refreshing instances
+	ttl             time.Duration // max ttl of answers, answers never outlive a next refresh
+	minTTL          time.Duration // ttl of answers after a next refresh is missed
+
+	reverseZones []string // reverse zones answering PTR(ex: 10.in-addr.arpa.)
+	txtTags      []string // tag(label) keys answered in TXT
+
+	snapshot string // path of a snapshot file, empty means disabled
+
+	staleMaxAge time.Duration // max age of stale records since a last refresh
+	staleAction string        // action for records stale longer than a max age
+}
+
+// allZones returns a primary zone and other zones.
+func (c *CommonConfig) allZones() []*zoneConfig {
+	return append([]*zoneConfig{&c.zoneConfig}, c.zones...)
+}
+
+// zoneConfig is a zone having its own nameserver, soa, mode and sources.
+type zoneConfig struct {
 	domain     string
-	port       string
 	rname      string
 	nameserver string
 	private    bool
+	fixed      bool // private is written in a zone, so views don't override it
+	cname      bool // answer CNAME to hostnames of providers instead of A and AAAA
+
+	soaRefresh time.Duration
+	soaRetry   time.Duration
+	soaExpire  time.Duration
+	soaMinimum time.Duration
+
+	sources []string // vendors or vendor/account(project) answered in a zone(ex: aws, aws/prod), empty means every sources
+}
+
+// viewConfig is a split-horizon view, clients or listeners matched to it get private or public ips.
+type viewConfig struct {
+	name      string
+	clients   []*net.IPNet // client networks, empty means every clients
+	listeners []net.IP     // local addresses receiving queries, empty means every listeners
+	private   bool
 }
 
 type AwsConfig struct {
-	clients map[string]*ec2.EC2 // map[region]client
+	accounts        []*awsAccount
+	pageSize        int64 // max results of DescribeInstances per page
+	naming          naming
+	refreshInterval time.Duration // zero means a common refresh interval
+	ttl             time.Duration // zero means a common ttl
+}
+
+type awsAccount struct {
+	sync.RWMutex
+	alias     string              // label scoping queries to this account, empty for a default account
+	clients   map[string]*ec2.EC2 // map[region]client
+	discovery *awsRegionDiscovery // nil when regions are listed in config
+	newClient func(region string) (*ec2.EC2, error)
 }
 
 type GcpConfig struct {
+	projects        []*gcpProject
+	naming          naming
+	refreshInterval time.Duration // zero means a common refresh interval
+	ttl             time.Duration // zero means a common ttl
+}
+
+type gcpProject struct {
 	projectId string
 	zones     []string
+	allZones  bool // look up every zones using aggregated list
 	client    *compute.Service
 }
 
-//domain, nameserver, port, rname string, private bool,
+// domain, nameserver, port, rname string, private bool,
 func ParseConfig(config map[interface{}]interface{}) (commonConfig *CommonConfig, awsConfig *AwsConfig, gcpConfig *GcpConfig, err error) {
 	if config == nil {
 		err = fmt.Errorf("[err] ParseConfig empty params")
@@ -112,6 +208,213 @@ func ParseConfig(config map[interface{}]interface{}) (commonConfig *CommonConfig
 		}
 	}
 
+	// cname
+	if v, ok := config["cname"]; ok {
+		cname, suberr := parseBool(v)
+		if suberr != nil {
+			commonConfig = nil
+			err = fmt.Errorf("[err] cname field is invalid.")
+			return
+		}
+		commonConfig.cname = cname
+	}
+
+	// get concurrency
+	commonConfig.concurrency = defaultConcurrency
+	if v, ok := config["concurrency"]; ok {
+		n, suberr := parseInt(v)
+		if suberr != nil || n <= 0 {
+			commonConfig = nil
+			err = fmt.Errorf("[err] concurrency field is invalid.")
+			return
+		}
+		commonConfig.concurrency = n
+	}
+
+	// get timeout
+	commonConfig.timeout = defaultTimeout
+	if v, ok := config["timeout"]; ok {
+		d, suberr := parseDuration(v)
+		if suberr != nil || d <= 0 {
+			commonConfig = nil
+			err = fmt.Errorf("[err] timeout field is invalid.")
+			return
+		}
+		commonConfig.timeout = d
+	}
+
+	// get reverse zones
+	if v, ok := config["reverse_zones"]; ok {
+		zones, suberr := parseStrings(v)
+		if suberr != nil {
+			commonConfig = nil
+			err = fmt.Errorf("[err] reverse_zones field is invalid.")
+			return
+		}
+		for _, zone := range zones {
+			zone = strings.ToLower(zone)
+			if !strings.HasSuffix(zone, ".") {
+				zone = zone + "."
+			}
+			if !isReverseZone(zone) {
+				commonConfig = nil
+				err = fmt.Errorf("[err] reverse_zones %s is not in-addr.arpa or ip6.arpa.", zone)
+				return
+			}
+			commonConfig.reverseZones = append(commonConfig.reverseZones, zone)
+		}
+	}
+
+	// get tag keys answered in TXT
+	if v, ok := config["txt_tags"]; ok {
+		keys, suberr := parseStrings(v)
+		if suberr != nil {
+			commonConfig = nil
+			err = fmt.Errorf("[err] txt_tags field is invalid.")
+			return
+		}
+		commonConfig.txtTags = keys
+	}
+
+	// get snapshot
+	if v, ok := config["snapshot"]; ok {
+		file, ok := v.(string)
+		if !ok || strings.TrimSpace(file) == "" {
+			commonConfig = nil
+			err = fmt.Errorf("[err] snapshot field is invalid.")
+			return
+		}
+		commonConfig.snapshot = strings.TrimSpace(file)
+	}
+
+	// get refresh interval, ttl and soa timers
+	soa, _ := config["soa"].(map[interface{}]interface{})
+	for _, field := range []struct {
+		name     string
+		raw      map[interface{}]interface{}
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{name: "refresh_interval", raw: config, value: &commonConfig.refreshInterval, fallback: defaultRefreshInterval},
+		{name: "ttl", raw: config, value: &commonConfig.ttl, fallback: TTL},
+		{name: "min_ttl", raw: config, value: &commonConfig.minTTL, fallback: defaultMinTTL},
+		{name: "refresh", raw: soa, value: &commonConfig.soaRefresh, fallback: defaultSoaRefresh},
+		{name: "retry", raw: soa, value: &commonConfig.soaRetry, fallback: defaultSoaRetry},
+		{name: "expire", raw: soa, value: &commonConfig.soaExpire, fallback: defaultSoaExpire},
+		{name: "minimum", raw: soa, value: &commonConfig.soaMinimum, fallback: defaultSoaMinimum},
+		{name: "stale_max_age", raw: config, value: &commonConfig.staleMaxAge, fallback: defaultStaleMaxAge},
+	} {
+		*field.value = field.fallback
+		if v, ok := field.raw[field.name]; ok {
+			d, suberr := parseDuration(v)
+			if suberr != nil || d <= 0 {
+				commonConfig = nil
+				err = fmt.Errorf("[err] %s field is invalid.", field.name)
+				return
+			}
+			*field.value = d
+		}
+	}
+
+	// get stale action
+	commonConfig.staleAction = staleActionDrop
+	if v, ok := config["stale_action"]; ok {
+		action, _ := v.(string)
+		action = strings.ToLower(strings.TrimSpace(action))
+		if action != staleActionDrop && action != staleActionServfail {
+			commonConfig = nil
+			err = fmt.Errorf("[err] stale_action field is invalid.")
+			return
+		}
+		commonConfig.staleAction = action
+	}
+
+	// get listen addresses
+	if v, ok := config["listen"]; ok {
+		addrs, suberr := parseStrings(v)
+		if suberr != nil {
+			commonConfig = nil
+			err = fmt.Errorf("[err] listen field is invalid.")
+			return
+		}
+		for _, addr := range addrs {
+			if net.ParseIP(addr) == nil {
+				commonConfig = nil
+				err = fmt.Errorf("[err] listen %s is not a ip.", addr)
+				return
+			}
+		}
+		commonConfig.listens = addrs
+	}
+
+	// get views
+	if v, ok := config["views"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			commonConfig = nil
+			err = fmt.Errorf("[err] views field is invalid.")
+			return
+		}
+		for _, raw := range list {
+			vv, ok := raw.(map[interface{}]interface{})
+			if !ok {
+				commonConfig = nil
+				err = fmt.Errorf("[err] views field is invalid.")
+				return
+			}
+			view, suberr := parseView(vv, commonConfig.listens)
+			if suberr != nil {
+				commonConfig = nil
+				err = suberr
+				return
+			}
+			commonConfig.views = append(commonConfig.views, view)
+		}
+	}
+
+	// get sources of a primary zone
+	if v, ok := config["sources"]; ok {
+		sources, suberr := parseSources(v)
+		if suberr != nil {
+			commonConfig = nil
+			err = suberr
+			return
+		}
+		commonConfig.sources = sources
+	}
+
+	// get zones, omitted fields are inherited from a primary zone
+	if v, ok := config["zones"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			commonConfig = nil
+			err = fmt.Errorf("[err] zones field is invalid.")
+			return
+		}
+		seen := map[string]bool{strings.ToLower(commonConfig.domain): true}
+		for _, raw := range list {
+			zv, ok := raw.(map[interface{}]interface{})
+			if !ok {
+				commonConfig = nil
+				err = fmt.Errorf("[err] zones field is invalid.")
+				return
+			}
+			zone, suberr := parseZone(zv, &commonConfig.zoneConfig)
+			if suberr != nil {
+				commonConfig = nil
+				err = suberr
+				return
+			}
+			if seen[strings.ToLower(zone.domain)] {
+				commonConfig = nil
+				err = fmt.Errorf("[err] zones %s is duplicated.", zone.domain)
+				return
+			}
+			seen[strings.ToLower(zone.domain)] = true
+			commonConfig.zones = append(commonConfig.zones, zone)
+		}
+	}
+
 	for name, v := range config {
 		switch name.(string) {
 		case "aws":
@@ -130,40 +433,9 @@ func ParseConfig(config map[interface{}]interface{}) (commonConfig *CommonConfig
 					enable = e
 				}
 				if enable {
-					ak, ok := v.(map[interface{}]interface{})["access_key"]
-					if !ok || strings.TrimSpace(ak.(string)) == "" {
-						continue
-					}
-					sak, ok := v.(map[interface{}]interface{})["secret_access_key"]
-					if !ok || strings.TrimSpace(sak.(string)) == "" {
-						continue
-					}
-					regions, ok := v.(map[interface{}]interface{})["regions"]
-					if !ok {
-						continue
-					}
-
-					accessKey := strings.TrimSpace(ak.(string))
-					secretAccessKey := strings.TrimSpace(sak.(string))
-					awsConfig = &AwsConfig{
-						clients: make(map[string]*ec2.EC2),
-					}
-					for _, r := range regions.([]interface{}) {
-						region := strings.TrimSpace(r.(string))
-						sess, suberr := session.NewSession(&aws.Config{
-							Region:      aws.String(region),
-							Credentials: credentials.NewStaticCredentials(accessKey, secretAccessKey, ""),
-						})
-						if suberr != nil {
-							err = suberr
-							return
-						}
-						awsservice := ec2.New(sess)
-						awsConfig.clients[region] = awsservice
-					}
-					// if valid client is not exist.
-					if len(awsConfig.clients) == 0 {
-						gcpConfig = nil
+					awsConfig, err = parseAwsConfig(v.(map[interface{}]interface{}))
+					if err != nil {
+						return
 					}
 				}
 			}
@@ -183,43 +455,741 @@ func ParseConfig(config map[interface{}]interface{}) (commonConfig *CommonConfig
 					enable = e
 				}
 				if enable {
-					projectId, ok := v.(map[interface{}]interface{})["project_id"]
-					if !ok || strings.TrimSpace(projectId.(string)) == "" {
-						continue
-					}
-					jwt, ok := v.(map[interface{}]interface{})["jwt"]
-					if !ok {
-						continue
-					}
-					zones, ok := v.(map[interface{}]interface{})["zones"]
-					if !ok {
-						continue
-					}
-
-					gcpConfig = &GcpConfig{
-						projectId: strings.TrimSpace(projectId.(string)),
-					}
-					for _, zone := range zones.([]interface{}) {
-						gcpConfig.zones = append(gcpConfig.zones, strings.TrimSpace(zone.(string)))
-					}
-					jwtConfig, suberr := google.JWTConfigFromJSON([]byte(jwt.(string)), compute.ComputeScope)
-					if suberr != nil {
-						err = suberr
-						return
-					}
-					gcpservice, suberr := compute.NewService(context.Background(), option.WithTokenSource(jwtConfig.TokenSource(context.Background())))
-					if suberr != nil {
-						err = suberr
+					gcpConfig, err = parseGcpConfig(v.(map[interface{}]interface{}))
+					if err != nil {
 						return
 					}
-					gcpConfig.client = gcpservice
-					// if zones is not exist.
-					if len(gcpConfig.zones) == 0 {
-						gcpConfig = nil
-					}
 				}
 			}
 		}
 	}
 	return
 }
+
+// parseAwsConfig returns nil config when required fields are missing.
+func parseAwsConfig(v map[interface{}]interface{}) (*AwsConfig, error) {
+	regions, hasRegions := v["regions"]
+	rawAccounts, hasAccounts := v["accounts"]
+	if !hasRegions && !hasAccounts {
+		return nil, nil
+	}
+
+	accessKey, secretAccessKey := "", ""
+	if ak, ok := v["access_key"]; ok {
+		accessKey = strings.TrimSpace(ak.(string))
+	}
+	if sak, ok := v["secret_access_key"]; ok {
+		secretAccessKey = strings.TrimSpace(sak.(string))
+	}
+
+	// get credential source, static when keys exist otherwise a default chain of sdk.
+	source := awsCredentialStatic
+	if accessKey == "" || secretAccessKey == "" {
+		source = awsCredentialDefault
+	}
+	if cs, ok := v["credential_source"]; ok {
+		value, err := parseString(cs)
+		if err != nil {
+			return nil, fmt.Errorf("[err] aws credential_source field is invalid.")
+		}
+		source = strings.ToLower(value)
+	}
+	profile := ""
+	if pf, ok := v["profile"]; ok {
+		value, err := parseString(pf)
+		if err != nil {
+			return nil, fmt.Errorf("[err] aws profile field is invalid.")
+		}
+		profile = value
+	}
+
+	awsConfig := &AwsConfig{pageSize: defaultAwsPageSize}
+
+	// get refresh interval and ttl of aws
+	refreshInterval, ttl, err := parseSchedule(v)
+	if err != nil {
+		return nil, err
+	}
+	awsConfig.refreshInterval = refreshInterval
+	awsConfig.ttl = ttl
+
+	// get page size(5 ~ 1000)
+	if ps, ok := v["page_size"]; ok {
+		pageSize, err := parseInt(ps)
+		if err != nil {
+			return nil, fmt.Errorf("[err] aws page_size field is invalid.")
+		}
+		if pageSize < 5 || pageSize > 1000 {
+			return nil, fmt.Errorf("[err] aws page_size must be between 5 and 1000.")
+		}
+		awsConfig.pageSize = int64(pageSize)
+	}
+
+	// get tag keys indexed and name templates
+	if awsConfig.naming, err = parseNaming(v, "index_tags"); err != nil {
+		return nil, err
+	}
+
+	var baseSess *session.Session
+	switch source {
+	case awsCredentialStatic:
+		if accessKey == "" || secretAccessKey == "" {
+			return nil, fmt.Errorf("[err] aws access_key and secret_access_key are required for static credentials.")
+		}
+		sess, err := session.NewSession(&aws.Config{
+			Region:      aws.String(defaultAwsStsRegion),
+			Credentials: credentials.NewStaticCredentials(accessKey, secretAccessKey, ""),
+		})
+		if err != nil {
+			return nil, err
+		}
+		baseSess = sess
+	case awsCredentialDefault:
+		// env, shared profile(~/.aws), web identity, container and instance profile
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:            aws.Config{Region: aws.String(defaultAwsStsRegion)},
+			Profile:           profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+		baseSess = sess
+	default:
+		return nil, fmt.Errorf("[err] aws credential_source field is invalid.")
+	}
+
+	// without accounts, instances of the credentials' account are looked up.
+	if !hasAccounts {
+		account, err := newAwsAccount("", baseSess.Config.Credentials, regions, v)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil {
+			awsConfig.accounts = append(awsConfig.accounts, account)
+		}
+	} else {
+		list, ok := rawAccounts.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[err] aws accounts field is invalid.")
+		}
+		aliases := make(map[string]bool)
+		for _, raw := range list {
+			rawAccount, ok := raw.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("[err] aws accounts field is invalid.")
+			}
+			alias, ok := rawAccount["alias"]
+			if !ok {
+				return nil, fmt.Errorf("[err] aws account alias is empty.")
+			}
+			accountAlias, err := parseString(alias)
+			if err != nil || accountAlias == "" {
+				return nil, fmt.Errorf("[err] aws account alias is empty.")
+			}
+			accountAlias = strings.ToLower(accountAlias)
+			// an alias is a label of queries, so it must be a valid label not meaning something else.
+			if accountAlias != normalizeLabel(accountAlias, false) {
+				return nil, fmt.Errorf("[err] aws account alias %s is not a valid label.", accountAlias)
+			}
+			switch accountAlias {
+			case "aws", "gcp", dnsRR, dnsTag, dnsPrivate, dnsPublic, dnsCname:
+				return nil, fmt.Errorf("[err] aws account alias %s is reserved.", accountAlias)
+			}
+			if aliases[accountAlias] {
+				return nil, fmt.Errorf("[err] aws account alias %s is duplicated.", accountAlias)
+			}
+			aliases[accountAlias] = true
+
+			rawRoleArn, ok := rawAccount["role_arn"]
+			if !ok {
+				return nil, fmt.Errorf("[err] aws account %s role_arn is empty.", accountAlias)
+			}
+			roleArn, err := parseString(rawRoleArn)
+			if err != nil || roleArn == "" {
+				return nil, fmt.Errorf("[err] aws account %s role_arn is empty.", accountAlias)
+			}
+			externalId := ""
+			if id, ok := rawAccount["external_id"]; ok {
+				externalId = strings.TrimSpace(fmt.Sprintf("%v", id))
+			}
+
+			// an account's regions are inherited when not exist.
+			accountRegions, ok := rawAccount["regions"]
+			if !ok {
+				if !hasRegions {
+					return nil, fmt.Errorf("[err] aws account %s regions is empty.", accountAlias)
+				}
+				accountRegions = regions
+			}
+
+			// assume role using the base credentials
+			creds := stscreds.NewCredentials(baseSess, roleArn, func(p *stscreds.AssumeRoleProvider) {
+				if externalId != "" {
+					p.ExternalID = aws.String(externalId)
+				}
+			})
+			account, err := newAwsAccount(accountAlias, creds, accountRegions, v)
+			if err != nil {
+				return nil, err
+			}
+			if account != nil {
+				awsConfig.accounts = append(awsConfig.accounts, account)
+			}
+		}
+	}
+
+	// if valid account is not exist.
+	if len(awsConfig.accounts) == 0 {
+		return nil, nil
+	}
+	return awsConfig, nil
+}
+
+// newAwsAccount returns nil account when any region is not exist.
+func newAwsAccount(alias string, creds *credentials.Credentials, regions interface{}, v map[interface{}]interface{}) (*awsAccount, error) {
+	account := &awsAccount{
+		alias:   alias,
+		clients: make(map[string]*ec2.EC2),
+	}
+
+	// a session client per region
+	account.newClient = func(region string) (*ec2.EC2, error) {
+		sess, err := session.NewSession(&aws.Config{
+			Region:      aws.String(region),
+			Credentials: creds,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ec2.New(sess), nil
+	}
+
+	staticRegions, discovery, err := parseAwsRegions(regions)
+	if err != nil {
+		return nil, err
+	}
+	if discovery != nil {
+		// get discovery region and interval
+		if dr, ok := v["discovery_region"]; ok {
+			region, err := parseString(dr)
+			if err != nil {
+				return nil, fmt.Errorf("[err] aws discovery_region field is invalid.")
+			}
+			if region != "" {
+				discovery.region = region
+			}
+		}
+		if di, ok := v["discovery_interval"]; ok {
+			interval, err := parseDuration(di)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("[err] aws discovery_interval field is invalid.")
+			}
+			discovery.interval = interval
+		}
+		account.discovery = discovery
+	}
+	for _, region := range staticRegions {
+		client, err := account.newClient(region)
+		if err != nil {
+			return nil, err
+		}
+		account.clients[region] = client
+	}
+
+	// if valid client is not exist.
+	if len(account.clients) == 0 && account.discovery == nil {
+		return nil, nil
+	}
+	return account, nil
+}
+
+// parseAwsRegions returns listed regions, or a discovery when regions are `all` or include/exclude patterns.
+func parseAwsRegions(regions interface{}) ([]string, *awsRegionDiscovery, error) {
+	switch regions.(type) {
+	case []interface{}:
+		var static []string
+		for _, r := range regions.([]interface{}) {
+			static = append(static, strings.TrimSpace(r.(string)))
+		}
+		return static, nil, nil
+	case string:
+		if strings.ToLower(strings.TrimSpace(regions.(string))) != awsAllRegions {
+			return nil, nil, fmt.Errorf("[err] aws regions field is invalid.")
+		}
+		return nil, newAwsRegionDiscovery(nil, nil), nil
+	case map[interface{}]interface{}:
+		patterns := map[string][]string{}
+		for _, name := range []string{"include", "exclude"} {
+			raw, ok := regions.(map[interface{}]interface{})[name]
+			if !ok {
+				continue
+			}
+			list, ok := raw.([]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("[err] aws regions %s field is invalid.", name)
+			}
+			for _, r := range list {
+				pattern := strings.TrimSpace(r.(string))
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, nil, fmt.Errorf("[err] aws regions pattern %s is invalid.", pattern)
+				}
+				patterns[name] = append(patterns[name], pattern)
+			}
+		}
+		return nil, newAwsRegionDiscovery(patterns["include"], patterns["exclude"]), nil
+	}
+	return nil, nil, fmt.Errorf("[err] aws regions field is invalid.")
+}
+
+// parseGcpConfig returns nil config when required fields are missing.
+func parseGcpConfig(v map[interface{}]interface{}) (*GcpConfig, error) {
+	// get refresh interval and ttl of gcp
+	refreshInterval, ttl, err := parseSchedule(v)
+	if err != nil {
+		return nil, err
+	}
+	gcpConfig := &GcpConfig{refreshInterval: refreshInterval, ttl: ttl}
+
+	// get label keys indexed and name templates
+	if gcpConfig.naming, err = parseNaming(v, "index_labels"); err != nil {
+		return nil, err
+	}
+
+	// without projects, a single project is looked up.
+	rawProjects, ok := v["projects"]
+	if !ok {
+		project, err := parseGcpProject(v, v["zones"], nil)
+		if err != nil {
+			return nil, err
+		}
+		if project == nil {
+			return nil, nil
+		}
+		gcpConfig.projects = append(gcpConfig.projects, project)
+		return gcpConfig, nil
+	}
+
+	list, ok := rawProjects.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[err] gcp projects field is invalid.")
+	}
+
+	// a client of gcp section is shared with projects not having own credentials.
+	var shared *compute.Service
+	projectIds := make(map[string]bool)
+	for _, raw := range list {
+		rawProject, ok := raw.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[err] gcp projects field is invalid.")
+		}
+		// zones of a gcp section are inherited when a project doesn't have them.
+		zones, ok := rawProject["zones"]
+		if !ok {
+			zones = v["zones"]
+		}
+
+		var client *compute.Service
+		if !hasGcpCredentials(rawProject) {
+			if shared == nil {
+				c, err := newGcpClient(v)
+				if err != nil {
+					return nil, err
+				}
+				shared = c
+			}
+			client = shared
+		}
+
+		project, err := parseGcpProject(rawProject, zones, client)
+		if err != nil {
+			return nil, err
+		}
+		if project == nil {
+			return nil, fmt.Errorf("[err] gcp projects require project_id and zones.")
+		}
+		if projectIds[project.projectId] {
+			return nil, fmt.Errorf("[err] gcp project %s is duplicated.", project.projectId)
+		}
+		projectIds[project.projectId] = true
+		gcpConfig.projects = append(gcpConfig.projects, project)
+	}
+
+	// if valid project is not exist.
+	if len(gcpConfig.projects) == 0 {
+		return nil, nil
+	}
+	return gcpConfig, nil
+}
+
+// parseGcpProject returns nil project when required fields are missing.
+// a new client is made from credentials of v when client is nil.
+func parseGcpProject(v map[interface{}]interface{}, zones interface{}, client *compute.Service) (*gcpProject, error) {
+	projectId, ok := v["project_id"]
+	if !ok || strings.TrimSpace(projectId.(string)) == "" {
+		return nil, nil
+	}
+	if zones == nil {
+		return nil, nil
+	}
+
+	project := &gcpProject{
+		projectId: strings.ToLower(strings.TrimSpace(projectId.(string))),
+	}
+	switch zones.(type) {
+	case string: // all zones are looked up by aggregated list
+		if strings.ToLower(strings.TrimSpace(zones.(string))) != gcpAllZones {
+			return nil, fmt.Errorf("[err] gcp zones field is invalid.")
+		}
+		project.allZones = true
+	case []interface{}:
+		for _, zone := range zones.([]interface{}) {
+			project.zones = append(project.zones, strings.TrimSpace(zone.(string)))
+		}
+	}
+	// if zones is not exist.
+	if len(project.zones) == 0 && !project.allZones {
+		return nil, nil
+	}
+
+	if client == nil {
+		c, err := newGcpClient(v)
+		if err != nil {
+			return nil, err
+		}
+		client = c
+	}
+	project.client = client
+	return project, nil
+}
+
+func hasGcpCredentials(v map[interface{}]interface{}) bool {
+	for _, name := range []string{"jwt", "credentials_file"} {
+		if value, ok := v[name]; ok && strings.TrimSpace(value.(string)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newGcpClient uses an inline jwt, a credentials file or application default credentials in order.
+func newGcpClient(v map[interface{}]interface{}) (*compute.Service, error) {
+	ctx := context.Background()
+
+	// inline service account json
+	if jwt, ok := v["jwt"]; ok && strings.TrimSpace(jwt.(string)) != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(jwt.(string)), compute.ComputeScope)
+		if err != nil {
+			return nil, err
+		}
+		return compute.NewService(ctx, option.WithTokenSource(jwtConfig.TokenSource(ctx)))
+	}
+
+	// service account json file
+	if file, ok := v["credentials_file"]; ok && strings.TrimSpace(file.(string)) != "" {
+		return compute.NewService(ctx, option.WithCredentialsFile(strings.TrimSpace(file.(string))), option.WithScopes(compute.ComputeScope))
+	}
+
+	// GOOGLE_APPLICATION_CREDENTIALS, gcloud ADC file or metadata server
+	creds, err := google.FindDefaultCredentials(ctx, compute.ComputeScope)
+	if err != nil {
+		return nil, err
+	}
+	return compute.NewService(ctx, option.WithTokenSource(creds.TokenSource))
+}
+
+// parseZone parses a zone of zones, fields not in a zone are copied from a parent zone.
+func parseZone(v map[interface{}]interface{}, parent *zoneConfig) (*zoneConfig, error) {
+	zone := *parent
+	zone.domain = ""
+
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{name: "domain", value: &zone.domain},
+		{name: "nameserver", value: &zone.nameserver},
+	} {
+		if raw, ok := v[field.name]; ok {
+			value, _ := raw.(string)
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil, fmt.Errorf("[err] zones %s field is invalid.", field.name)
+			}
+			*field.value = dns.Fqdn(value)
+		}
+	}
+	if zone.domain == "" {
+		return nil, fmt.Errorf("[err] zones empty domain")
+	}
+
+	if raw, ok := v["email"]; ok {
+		email, ok := raw.(string)
+		if !ok || strings.TrimSpace(email) == "" {
+			return nil, fmt.Errorf("[err] zones email field is invalid.")
+		}
+		zone.rname = strings.Replace(strings.TrimSpace(email), "@", ".", -1) + "."
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *bool
+	}{
+		{name: "private", value: &zone.private},
+		{name: "cname", value: &zone.cname},
+	} {
+		if raw, ok := v[field.name]; ok {
+			value, err := parseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("[err] zones %s field is invalid.", field.name)
+			}
+			*field.value = value
+		}
+	}
+	_, zone.fixed = v["private"]
+
+	soa, _ := v["soa"].(map[interface{}]interface{})
+	for _, field := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{name: "refresh", value: &zone.soaRefresh},
+		{name: "retry", value: &zone.soaRetry},
+		{name: "expire", value: &zone.soaExpire},
+		{name: "minimum", value: &zone.soaMinimum},
+	} {
+		if raw, ok := soa[field.name]; ok {
+			d, err := parseDuration(raw)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("[err] zones soa %s field is invalid.", field.name)
+			}
+			*field.value = d
+		}
+	}
+
+	if raw, ok := v["sources"]; ok {
+		sources, err := parseSources(raw)
+		if err != nil {
+			return nil, err
+		}
+		zone.sources = sources
+	}
+	return &zone, nil
+}
+
+// parseView parses a view, a view must have clients or listeners.
+// listeners must be in listens, because a local address of a wildcard socket is the wildcard.
+func parseView(v map[interface{}]interface{}, listens []string) (*viewConfig, error) {
+	view := &viewConfig{}
+	if raw, ok := v["name"]; ok {
+		view.name, _ = raw.(string)
+	}
+
+	if raw, ok := v["clients"]; ok {
+		clients, err := parseStrings(raw)
+		if err != nil {
+			return nil, fmt.Errorf("[err] views clients field is invalid.")
+		}
+		for _, client := range clients {
+			// a ip without a prefix length is a network of the ip only
+			if ip := net.ParseIP(client); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				view.clients = append(view.clients, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			_, network, err := net.ParseCIDR(client)
+			if err != nil {
+				return nil, fmt.Errorf("[err] views clients %s is not a cidr.", client)
+			}
+			view.clients = append(view.clients, network)
+		}
+	}
+
+	if raw, ok := v["listeners"]; ok {
+		listeners, err := parseStrings(raw)
+		if err != nil {
+			return nil, fmt.Errorf("[err] views listeners field is invalid.")
+		}
+		for _, listener := range listeners {
+			ip := net.ParseIP(listener)
+			if ip == nil {
+				return nil, fmt.Errorf("[err] views listeners %s is not a ip.", listener)
+			}
+			listened := false
+			for _, addr := range listens {
+				if ip.Equal(net.ParseIP(addr)) {
+					listened = true
+					break
+				}
+			}
+			if !listened {
+				return nil, fmt.Errorf("[err] views listeners %s is not in listen.", listener)
+			}
+			view.listeners = append(view.listeners, ip)
+		}
+	}
+
+	if len(view.clients) == 0 && len(view.listeners) == 0 {
+		return nil, fmt.Errorf("[err] views %s has neither clients nor listeners.", view.name)
+	}
+
+	if raw, ok := v["private"]; ok {
+		private, err := parseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("[err] views private field is invalid.")
+		}
+		view.private = private
+	}
+	return view, nil
+}
+
+// parseSources parses sources of a zone(ex: aws, aws/prod, gcp/my-project).
+func parseSources(v interface{}) ([]string, error) {
+	sources, err := parseStrings(v)
+	if err != nil {
+		return nil, fmt.Errorf("[err] sources field is invalid.")
+	}
+	for i, source := range sources {
+		source = strings.ToLower(source)
+		seps := strings.SplitN(source, "/", 2)
+		vendor := seps[0]
+		if vendor != "aws" && vendor != "gcp" {
+			return nil, fmt.Errorf("[err] sources %s is not aws or gcp.", source)
+		}
+		if len(seps) == 2 && seps[1] == "" {
+			return nil, fmt.Errorf("[err] sources %s is invalid.", source)
+		}
+		sources[i] = source
+	}
+	return sources, nil
+}
+
+// parseNaming returns tag keys indexed, name templates and idna of a provider section.
+func parseNaming(v map[interface{}]interface{}, indexKey string) (naming, error) {
+	n := naming{}
+	if raw, ok := v[indexKey]; ok {
+		keys, err := parseStrings(raw)
+		if err != nil {
+			return n, fmt.Errorf("[err] %s field is invalid.", indexKey)
+		}
+		n.indexTags = keys
+	}
+
+	if raw, ok := v["name_templates"]; ok {
+		texts, err := parseStrings(raw)
+		if err != nil {
+			return n, fmt.Errorf("[err] name_templates field is invalid.")
+		}
+		for _, text := range texts {
+			// a missing tag fails a template instead of generating "<no value>"
+			tmpl, err := template.New(text).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return n, fmt.Errorf("[err] name_templates %s is invalid. %v", text, err)
+			}
+			n.templates = append(n.templates, tmpl)
+		}
+	}
+
+	if raw, ok := v["idna"]; ok {
+		idn, err := parseBool(raw)
+		if err != nil {
+			return n, fmt.Errorf("[err] idna field is invalid.")
+		}
+		n.idn = idn
+	}
+
+	if raw, ok := v["name_template_mode"]; ok {
+		mode, _ := raw.(string)
+		switch strings.ToLower(strings.TrimSpace(mode)) {
+		case nameTemplateAppend:
+		case nameTemplateReplace:
+			n.replace = true
+		default:
+			return n, fmt.Errorf("[err] name_template_mode field is invalid.")
+		}
+	}
+	return n, nil
+}
+
+// parseSchedule returns refresh interval and ttl of a provider section, zero when not exist.
+func parseSchedule(v map[interface{}]interface{}) (refreshInterval, ttl time.Duration, err error) {
+	if ri, ok := v["refresh_interval"]; ok {
+		refreshInterval, err = parseDuration(ri)
+		if err != nil || refreshInterval <= 0 {
+			err = fmt.Errorf("[err] refresh_interval field is invalid.")
+			return
+		}
+	}
+	if t, ok := v["ttl"]; ok {
+		ttl, err = parseDuration(t)
+		if err != nil || ttl <= 0 {
+			err = fmt.Errorf("[err] ttl field is invalid.")
+			return
+		}
+	}
+	return
+}
+
+// parseInt parses a yaml number or a numeric string.
+func parseInt(v interface{}) (int, error) {
+	switch v.(type) {
+	case int:
+		return v.(int), nil
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v.(string)))
+	}
+	return 0, fmt.Errorf("[err] %v is not a number", v)
+}
+
+// parseString parses a yaml string or a number as a string(ex: an account id).
+func parseString(v interface{}) (string, error) {
+	switch v.(type) {
+	case string:
+		return strings.TrimSpace(v.(string)), nil
+	case int, int64, uint64, float64:
+		return fmt.Sprintf("%v", v), nil
+	}
+	return "", fmt.Errorf("[err] %v is not a string", v)
+}
+
+// parseBool parses a yaml bool or a bool string.
+func parseBool(v interface{}) (bool, error) {
+	switch v.(type) {
+	case bool:
+		return v.(bool), nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(v.(string)))
+	}
+	return false, fmt.Errorf("[err] %v is not a bool", v)
+}
+
+// parseStrings parses a yaml list of strings, empty strings are not allowed.
+func parseStrings(v interface{}) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[err] %v is not a list", v)
+	}
+	var values []string
+	for _, raw := range list {
+		value, ok := raw.(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("[err] %v is not a string", raw)
+		}
+		values = append(values, strings.TrimSpace(value))
+	}
+	return values, nil
+}
+
+// parseDuration parses a duration string(ex: 30s, 5m) or seconds.
+func parseDuration(v interface{}) (time.Duration, error) {
+	switch v.(type) {
+	case int:
+		return time.Duration(v.(int)) * time.Second, nil
+	case string:
+		return time.ParseDuration(strings.TrimSpace(v.(string)))
+	}
+	return 0, fmt.Errorf("[err] %v is not a duration", v)
+}
@@ -3,9 +3,12 @@ package server
 import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -23,7 +26,7 @@ func TestParseConfig(t *testing.T) {
 		"empty":       {input: nil, err: true},
 		"emptyDomain": {input: make(map[interface{}]interface{}), err: true},
 		"success": {input: map[interface{}]interface{}{
-			"domain": "localhost"}, err: false, commonConfig: &CommonConfig{domain: "localhost."}},
+			"domain": "localhost"}, err: false, commonConfig: &CommonConfig{zoneConfig: zoneConfig{domain: "localhost."}}},
 	}
 
 	for _, t := range tests {
@@ -40,6 +43,444 @@ func TestParseConfig(t *testing.T) {
 		}
 	}
 
+	// concurrency and timeout
+	fetchTests := map[string]struct {
+		input       map[interface{}]interface{}
+		concurrency int
+		timeout     time.Duration
+		err         bool
+	}{
+		"default":            {input: map[interface{}]interface{}{}, concurrency: defaultConcurrency, timeout: defaultTimeout},
+		"set":                {input: map[interface{}]interface{}{"concurrency": 3, "timeout": "10s"}, concurrency: 3, timeout: 10 * time.Second},
+		"seconds":            {input: map[interface{}]interface{}{"concurrency": "4", "timeout": 5}, concurrency: 4, timeout: 5 * time.Second},
+		"invalidConcurrency": {input: map[interface{}]interface{}{"concurrency": 0}, err: true},
+		"invalidTimeout":     {input: map[interface{}]interface{}{"timeout": "soon"}, err: true},
+	}
+	for _, t := range fetchTests {
+		t.input["domain"] = "localhost"
+		co, _, _, err := ParseConfig(t.input)
+		if t.err {
+			assert.Error(err)
+			assert.Nil(co)
+		} else {
+			assert.NoError(err)
+			assert.Equal(t.concurrency, co.concurrency)
+			assert.Equal(t.timeout, co.timeout)
+		}
+	}
+
+	// refresh interval, ttl and soa timers
+	co, _, _, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost"})
+	assert.NoError(err)
+	assert.Equal(defaultRefreshInterval, co.refreshInterval)
+	assert.Equal(TTL, co.ttl)
+	assert.Equal(defaultMinTTL, co.minTTL)
+	assert.Equal(defaultSoaRefresh, co.soaRefresh)
+	assert.Equal(defaultSoaRetry, co.soaRetry)
+	assert.Equal(defaultSoaExpire, co.soaExpire)
+	assert.Equal(defaultSoaMinimum, co.soaMinimum)
+
+	co, ac, gc, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost",
+		"refresh_interval": "2m", "ttl": 60, "min_ttl": "1s",
+		"soa": map[interface{}]interface{}{"refresh": "1h", "retry": "10m", "expire": "48h", "minimum": "30s"},
+		"aws": map[interface{}]interface{}{"enable": true, "access_key": "fake", "secret_access_key": "fake",
+			"regions": []interface{}{"ap-northeast-2"}, "refresh_interval": "5m", "ttl": "10m"},
+		"gcp": map[interface{}]interface{}{"enable": true, "project_id": "fake-project", "zones": "all",
+			"jwt": `{"type": "service_account", "private_key": "fake", "client_email": "fake@fake-project.iam.gserviceaccount.com"}`},
+	})
+	assert.NoError(err)
+	assert.Equal(2*time.Minute, co.refreshInterval)
+	assert.Equal(time.Minute, co.ttl)
+	assert.Equal(time.Second, co.minTTL)
+	assert.Equal(time.Hour, co.soaRefresh)
+	assert.Equal(10*time.Minute, co.soaRetry)
+	assert.Equal(48*time.Hour, co.soaExpire)
+	assert.Equal(30*time.Second, co.soaMinimum)
+	assert.Equal(5*time.Minute, ac.refreshInterval)
+	assert.Equal(10*time.Minute, ac.ttl)
+	assert.Equal(time.Duration(0), gc.refreshInterval)
+	assert.Equal(time.Duration(0), gc.ttl)
+
+	for _, input := range []map[interface{}]interface{}{
+		{"domain": "localhost", "ttl": "0s"},
+		{"domain": "localhost", "soa": map[interface{}]interface{}{"retry": "often"}},
+		{"domain": "localhost", "aws": map[interface{}]interface{}{"enable": true, "regions": []interface{}{"ap-northeast-2"}, "ttl": "-1m"}},
+	} {
+		_, _, _, err := ParseConfig(input)
+		assert.Error(err)
+	}
+
+	// reverse zones
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "reverse_zones": []interface{}{"10.in-addr.arpa", "8.B.D.0.1.0.0.2.ip6.arpa."}})
+	assert.NoError(err)
+	assert.Equal([]string{"10.in-addr.arpa.", "8.b.d.0.1.0.0.2.ip6.arpa."}, co.reverseZones)
+	_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "reverse_zones": []interface{}{"example.com"}})
+	assert.Error(err)
+
+	// tags answered in TXT
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "txt_tags": []interface{}{"role", "env"}})
+	assert.NoError(err)
+	assert.Equal([]string{"role", "env"}, co.txtTags)
+	_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "txt_tags": "role"})
+	assert.Error(err)
+
+	// zones
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "nameserver": "ns.localhost", "email": "dns@localhost",
+		"soa": map[interface{}]interface{}{"minimum": "1m"}, "sources": []interface{}{"AWS"},
+		"zones": []interface{}{
+			map[interface{}]interface{}{"domain": "int.localhost", "private": true, "sources": []interface{}{"aws/Prod", "GCP/my-project"}},
+			map[interface{}]interface{}{"domain": "pub.localhost.", "nameserver": "ns.pub.localhost", "email": "pub@localhost",
+				"cname": "true", "soa": map[interface{}]interface{}{"minimum": "30s"}},
+		}})
+	assert.NoError(err)
+	assert.Equal([]string{"aws"}, co.sources)
+	assert.Len(co.zones, 2)
+	assert.Equal(&zoneConfig{domain: "int.localhost.", nameserver: "ns.localhost.", rname: "dns.localhost.", private: true, fixed: true,
+		soaRefresh: defaultSoaRefresh, soaRetry: defaultSoaRetry, soaExpire: defaultSoaExpire, soaMinimum: time.Minute,
+		sources: []string{"aws/prod", "gcp/my-project"}}, co.zones[0])
+	assert.Equal(&zoneConfig{domain: "pub.localhost.", nameserver: "ns.pub.localhost.", rname: "pub.localhost.", cname: true,
+		soaRefresh: defaultSoaRefresh, soaRetry: defaultSoaRetry, soaExpire: defaultSoaExpire, soaMinimum: 30 * time.Second,
+		sources: []string{"aws"}}, co.zones[1])
+	assert.Len(co.allZones(), 3)
+	for _, zones := range [][]interface{}{
+		{map[interface{}]interface{}{"private": true}},
+		{map[interface{}]interface{}{"domain": "localhost"}},
+		{map[interface{}]interface{}{"domain": "a.localhost"}, map[interface{}]interface{}{"domain": "A.localhost."}},
+		{map[interface{}]interface{}{"domain": "a.localhost", "sources": []interface{}{"azure"}}},
+		{map[interface{}]interface{}{"domain": "a.localhost", "soa": map[interface{}]interface{}{"retry": "often"}}},
+		{"a.localhost"},
+	} {
+		_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "zones": zones})
+		assert.Error(err)
+	}
+
+	// listen addresses and views
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "listen": []interface{}{"10.0.0.53", "::1"},
+		"views": []interface{}{
+			map[interface{}]interface{}{"name": "vpc", "clients": []interface{}{"10.0.0.0/8", "fd00::/8"}, "private": true},
+			map[interface{}]interface{}{"name": "office", "clients": []interface{}{"203.0.113.7"}, "listeners": []interface{}{"10.0.0.53"}},
+		}})
+	assert.NoError(err)
+	assert.Equal([]string{"10.0.0.53", "::1"}, co.listens)
+	assert.Len(co.views, 2)
+	assert.Equal("vpc", co.views[0].name)
+	assert.True(co.views[0].private)
+	assert.Equal("fd00::/8", co.views[0].clients[1].String())
+	assert.Equal("203.0.113.7/32", co.views[1].clients[0].String())
+	assert.False(co.views[1].private)
+	assert.True(net.ParseIP("10.0.0.53").Equal(co.views[1].listeners[0]))
+	for _, config := range []map[interface{}]interface{}{
+		{"domain": "localhost", "listen": []interface{}{"localhost"}},
+		{"domain": "localhost", "views": []interface{}{map[interface{}]interface{}{"name": "empty", "private": true}}},
+		{"domain": "localhost", "views": []interface{}{map[interface{}]interface{}{"clients": []interface{}{"10.0.0.0/33"}}}},
+		{"domain": "localhost", "views": []interface{}{map[interface{}]interface{}{"listeners": []interface{}{"10.0.0.0/8"}}}},
+		{"domain": "localhost", "views": []interface{}{map[interface{}]interface{}{"listeners": []interface{}{"10.0.0.53"}}}},
+		{"domain": "localhost", "listen": []interface{}{"10.0.0.54"}, "views": []interface{}{map[interface{}]interface{}{"listeners": []interface{}{"10.0.0.53"}}}},
+		{"domain": "localhost", "views": []interface{}{map[interface{}]interface{}{"clients": []interface{}{"10.0.0.0/8"}, "private": "maybe"}}},
+		{"domain": "localhost", "views": map[interface{}]interface{}{"clients": []interface{}{"10.0.0.0/8"}}},
+	} {
+		_, _, _, err = ParseConfig(config)
+		assert.Error(err)
+	}
+
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "cname": "true"})
+	assert.NoError(err)
+	assert.True(co.cname)
+	_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "cname": "yes"})
+	assert.Error(err)
+
+	// snapshot
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "snapshot": " /tmp/snapshot.json "})
+	assert.NoError(err)
+	assert.Equal("/tmp/snapshot.json", co.snapshot)
+	_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "snapshot": ""})
+	assert.Error(err)
+
+	// stale max age and action
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost"})
+	assert.NoError(err)
+	assert.Equal(defaultStaleMaxAge, co.staleMaxAge)
+	assert.Equal(staleActionDrop, co.staleAction)
+	co, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "stale_max_age": "72h", "stale_action": "SERVFAIL"})
+	assert.NoError(err)
+	assert.Equal(72*time.Hour, co.staleMaxAge)
+	assert.Equal(staleActionServfail, co.staleAction)
+	_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "stale_action": "ignore"})
+	assert.Error(err)
+
+	// indexed tags and labels
+	_, ac, gc, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost",
+		"aws": map[interface{}]interface{}{"enable": true, "access_key": "fake", "secret_access_key": "fake",
+			"regions": []interface{}{"ap-northeast-2"}, "index_tags": []interface{}{"role", " service "}},
+		"gcp": map[interface{}]interface{}{"enable": true, "project_id": "fake-project", "zones": "all", "index_labels": []interface{}{"env"},
+			"jwt": `{"type": "service_account", "private_key": "fake", "client_email": "fake@fake-project.iam.gserviceaccount.com"}`},
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"role", "service"}, ac.naming.indexTags)
+	assert.Equal([]string{"env"}, gc.naming.indexTags)
+	_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost",
+		"aws": map[interface{}]interface{}{"enable": true, "access_key": "fake", "secret_access_key": "fake",
+			"regions": []interface{}{"ap-northeast-2"}, "index_tags": "role"},
+	})
+	assert.Error(err)
+
+	// name templates
+	_, ac, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost",
+		"aws": map[interface{}]interface{}{"enable": true, "access_key": "fake", "secret_access_key": "fake", "regions": []interface{}{"ap-northeast-2"},
+			"name_templates": []interface{}{"{{.Tags.service}}-{{.Tags.env}}"}, "name_template_mode": "replace", "idna": "true"},
+	})
+	assert.NoError(err)
+	assert.Len(ac.naming.templates, 1)
+	assert.True(ac.naming.replace)
+	assert.True(ac.naming.idn)
+	for _, aws := range []map[interface{}]interface{}{
+		{"name_templates": []interface{}{"{{.Tags.service"}},
+		{"name_templates": "{{.Tags.service}}"},
+		{"name_template_mode": "overwrite"},
+		{"idna": "sometimes"},
+	} {
+		aws["enable"] = true
+		aws["access_key"] = "fake"
+		aws["secret_access_key"] = "fake"
+		aws["regions"] = []interface{}{"ap-northeast-2"}
+		_, _, _, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "aws": aws})
+		assert.Error(err)
+	}
+
+	// aws page size
+	pageSizeTests := map[string]struct {
+		input    interface{}
+		pageSize int64
+		err      bool
+	}{
+		"default": {input: nil, pageSize: defaultAwsPageSize},
+		"int":     {input: 50, pageSize: 50},
+		"string":  {input: "100", pageSize: 100},
+		"small":   {input: 1, err: true},
+		"large":   {input: 1001, err: true},
+		"invalid": {input: "many", err: true},
+	}
+	for _, t := range pageSizeTests {
+		aws := map[interface{}]interface{}{
+			"enable": true, "access_key": "fake", "secret_access_key": "fake",
+			"regions": []interface{}{"ap-northeast-2"},
+		}
+		if t.input != nil {
+			aws["page_size"] = t.input
+		}
+		_, ac, _, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost", "aws": aws})
+		if t.err {
+			assert.Error(err)
+			assert.Nil(ac)
+		} else {
+			assert.NoError(err)
+			assert.Equal(t.pageSize, ac.pageSize)
+			assert.Len(ac.accounts, 1)
+			assert.Len(ac.accounts[0].clients, 1)
+		}
+	}
+
+	// aws regions
+	regionTests := map[string]struct {
+		input     interface{}
+		clients   int
+		discovery *awsRegionDiscovery
+		err       bool
+	}{
+		"list":     {input: []interface{}{"ap-northeast-1", "ap-northeast-2"}, clients: 2},
+		"all":      {input: "all", discovery: newAwsRegionDiscovery(nil, nil)},
+		"patterns": {input: map[interface{}]interface{}{"include": []interface{}{"ap-*"}, "exclude": []interface{}{"ap-south-*"}}, discovery: newAwsRegionDiscovery([]string{"ap-*"}, []string{"ap-south-*"})},
+		"invalid":  {input: "some", err: true},
+		"pattern":  {input: map[interface{}]interface{}{"include": []interface{}{"ap-["}}, err: true},
+	}
+	for _, t := range regionTests {
+		_, ac, _, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost", "aws": map[interface{}]interface{}{
+			"enable": true, "access_key": "fake", "secret_access_key": "fake", "regions": t.input,
+		}})
+		if t.err {
+			assert.Error(err)
+			assert.Nil(ac)
+		} else {
+			assert.NoError(err)
+			assert.Len(ac.accounts, 1)
+			assert.Len(ac.accounts[0].clients, t.clients)
+			assert.Equal(t.discovery, ac.accounts[0].discovery)
+		}
+	}
+
+	// aws accounts
+	accountTests := map[string]struct {
+		input   []interface{}
+		aliases []string
+		regions []int
+		err     bool
+	}{
+		"inherit": {input: []interface{}{
+			map[interface{}]interface{}{"alias": "Prod", "role_arn": "arn:aws:iam::111111111111:role/dns", "external_id": "fake"},
+			map[interface{}]interface{}{"alias": "dev", "role_arn": "arn:aws:iam::222222222222:role/dns", "regions": []interface{}{"us-east-1", "us-west-2", "eu-west-1"}},
+		}, aliases: []string{"prod", "dev"}, regions: []int{1, 3}},
+		"numericAlias": {input: []interface{}{
+			map[interface{}]interface{}{"alias": 111111111111, "role_arn": "arn:aws:iam::111111111111:role/dns"},
+		}, aliases: []string{"111111111111"}, regions: []int{1}},
+		"listAlias": {input: []interface{}{
+			map[interface{}]interface{}{"alias": []interface{}{"prod"}, "role_arn": "arn:aws:iam::111111111111:role/dns"},
+		}, err: true},
+		"emptyAlias": {input: []interface{}{
+			map[interface{}]interface{}{"role_arn": "arn:aws:iam::111111111111:role/dns"},
+		}, err: true},
+		"emptyRole": {input: []interface{}{
+			map[interface{}]interface{}{"alias": "prod"},
+		}, err: true},
+		"invalidAlias": {input: []interface{}{
+			map[interface{}]interface{}{"alias": "prod env", "role_arn": "arn:aws:iam::111111111111:role/dns"},
+		}, err: true},
+		"reservedAlias": {input: []interface{}{
+			map[interface{}]interface{}{"alias": "Private", "role_arn": "arn:aws:iam::111111111111:role/dns"},
+		}, err: true},
+		"duplicated": {input: []interface{}{
+			map[interface{}]interface{}{"alias": "prod", "role_arn": "arn:aws:iam::111111111111:role/dns"},
+			map[interface{}]interface{}{"alias": "prod", "role_arn": "arn:aws:iam::222222222222:role/dns"},
+		}, err: true},
+	}
+	for _, t := range accountTests {
+		_, ac, _, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost", "aws": map[interface{}]interface{}{
+			"enable": true, "access_key": "fake", "secret_access_key": "fake",
+			"regions": []interface{}{"ap-northeast-2"}, "accounts": t.input,
+		}})
+		if t.err {
+			assert.Error(err)
+			assert.Nil(ac)
+		} else {
+			assert.NoError(err)
+			assert.Len(ac.accounts, len(t.aliases))
+			for i, account := range ac.accounts {
+				assert.Equal(t.aliases[i], account.alias)
+				assert.Len(account.clients, t.regions[i])
+			}
+		}
+	}
+
+	// aws credential source
+	dir, err := ioutil.TempDir("", "cloud-instance-dns")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	credentialsPath := filepath.Join(dir, "credentials")
+	assert.NoError(ioutil.WriteFile(credentialsPath, []byte("[fake]\naws_access_key_id = profile-key\naws_secret_access_key = profile-secret\n"), 0600))
+	defer os.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.Getenv("AWS_SHARED_CREDENTIALS_FILE"))
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsPath)
+
+	credentialTests := map[string]struct {
+		input     map[interface{}]interface{}
+		accessKey string
+		err       bool
+	}{
+		"static":        {input: map[interface{}]interface{}{"access_key": "static-key", "secret_access_key": "static-secret"}, accessKey: "static-key"},
+		"staticEmpty":   {input: map[interface{}]interface{}{"credential_source": "static"}, err: true},
+		"default":       {input: map[interface{}]interface{}{}},
+		"defaultSource": {input: map[interface{}]interface{}{"access_key": "static-key", "secret_access_key": "static-secret", "credential_source": "default"}},
+		"profile":       {input: map[interface{}]interface{}{"credential_source": "default", "profile": "fake"}, accessKey: "profile-key"},
+		"invalid":       {input: map[interface{}]interface{}{"credential_source": "some"}, err: true},
+	}
+	for _, t := range credentialTests {
+		t.input["enable"] = true
+		t.input["regions"] = []interface{}{"ap-northeast-2"}
+		_, ac, _, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost", "aws": t.input})
+		if t.err {
+			assert.Error(err)
+			assert.Nil(ac)
+			continue
+		}
+		assert.NoError(err)
+		assert.Len(ac.accounts, 1)
+		if t.accessKey != "" {
+			value, err := ac.accounts[0].clients["ap-northeast-2"].Config.Credentials.Get()
+			assert.NoError(err)
+			assert.Equal(t.accessKey, value.AccessKeyID)
+		}
+	}
+
+	// gcp credentials
+	serviceAccount := `{"type": "service_account", "project_id": "fake-project", "private_key_id": "fake",
+"private_key": "fake", "client_email": "fake@fake-project.iam.gserviceaccount.com", "client_id": "1",
+"token_uri": "https://oauth2.googleapis.com/token"}`
+	serviceAccountPath := filepath.Join(dir, "service-account.json")
+	assert.NoError(ioutil.WriteFile(serviceAccountPath, []byte(serviceAccount), 0600))
+	defer os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", serviceAccountPath)
+
+	gcpCredentialTests := map[string]struct {
+		input map[interface{}]interface{}
+		err   bool
+	}{
+		"jwt":         {input: map[interface{}]interface{}{"jwt": serviceAccount}},
+		"invalidJwt":  {input: map[interface{}]interface{}{"jwt": "{"}, err: true},
+		"file":        {input: map[interface{}]interface{}{"credentials_file": serviceAccountPath}},
+		"missingFile": {input: map[interface{}]interface{}{"credentials_file": filepath.Join(dir, "missing.json")}, err: true},
+		"default":     {input: map[interface{}]interface{}{}},
+	}
+	for _, t := range gcpCredentialTests {
+		t.input["enable"] = true
+		t.input["project_id"] = "fake-project"
+		t.input["zones"] = []interface{}{"asia-northeast1-a"}
+		_, _, gc, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost", "gcp": t.input})
+		if t.err {
+			assert.Error(err)
+			assert.Nil(gc)
+		} else {
+			assert.NoError(err)
+			assert.Len(gc.projects, 1)
+			assert.NotNil(gc.projects[0].client)
+		}
+	}
+
+	// gcp projects
+	projectTests := map[string]struct {
+		input    []interface{}
+		projects []string
+		allZones []bool
+		shared   []bool
+		err      bool
+	}{
+		"projects": {input: []interface{}{
+			map[interface{}]interface{}{"project_id": "Project-A"},
+			map[interface{}]interface{}{"project_id": "project-b", "zones": "all", "credentials_file": serviceAccountPath},
+			map[interface{}]interface{}{"project_id": "project-c", "zones": []interface{}{"asia-northeast1-b"}},
+		}, projects: []string{"project-a", "project-b", "project-c"}, allZones: []bool{false, true, false}, shared: []bool{true, false, true}},
+		"emptyProjectId": {input: []interface{}{
+			map[interface{}]interface{}{"zones": "all"},
+		}, err: true},
+		"duplicated": {input: []interface{}{
+			map[interface{}]interface{}{"project_id": "project-a"},
+			map[interface{}]interface{}{"project_id": "project-a"},
+		}, err: true},
+	}
+	for _, t := range projectTests {
+		_, _, gc, err := ParseConfig(map[interface{}]interface{}{"domain": "localhost", "gcp": map[interface{}]interface{}{
+			"enable": true, "jwt": serviceAccount, "zones": []interface{}{"asia-northeast1-a"}, "projects": t.input,
+		}})
+		if t.err {
+			assert.Error(err)
+			assert.Nil(gc)
+			continue
+		}
+		assert.NoError(err)
+		assert.Len(gc.projects, len(t.projects))
+		for i, project := range gc.projects {
+			assert.Equal(t.projects[i], project.projectId)
+			assert.Equal(t.allZones[i], project.allZones)
+			assert.Equal(t.shared[i], project.client == gc.projects[0].client)
+		}
+	}
+
+	// inherited zones are not written into a config
+	rawProject := map[interface{}]interface{}{"project_id": "project-a"}
+	_, _, gc, err = ParseConfig(map[interface{}]interface{}{"domain": "localhost", "gcp": map[interface{}]interface{}{
+		"enable": true, "jwt": serviceAccount, "zones": []interface{}{"asia-northeast1-a"}, "projects": []interface{}{rawProject},
+	}})
+	assert.NoError(err)
+	assert.Equal([]string{"asia-northeast1-a"}, gc.projects[0].zones)
+	assert.NotContains(rawProject, "zones")
+
 	yamlPath := os.Getenv("TEST_YAML_PATH")
 	if yamlPath != "" {
 		config := make(map[interface{}]interface{})
@@ -59,10 +500,10 @@ func TestParseConfig(t *testing.T) {
 		assert.Equal(config["private"], co.private)
 		assert.NotEmpty(ac)
 		assert.NotEmpty(gc)
-		assert.NotEqual(0, len(ac.clients))
-		assert.NotEmpty(gc.projectId)
-		assert.NotEmpty(gc.zones)
-		assert.NotEmpty(gc.client)
+		assert.NotEqual(0, len(ac.accounts))
+		assert.NotEmpty(gc.projects)
+		assert.NotEmpty(gc.projects[0].projectId)
+		assert.NotEmpty(gc.projects[0].client)
 
 		// gcp enable off
 		config["gcp"].(map[interface{}]interface{})["enable"] = "false"
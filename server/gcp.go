@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+const (
+	gcpRunningFilter = "status = RUNNING"
+	gcpAllZones      = "all"
+)
+
+type gcpProvider struct {
+	conf *GcpConfig
+}
+
+// NewGcpProvider returns a provider looking up running compute-engine instances.
+func NewGcpProvider(conf *GcpConfig) InstanceProvider {
+	return &gcpProvider{conf: conf}
+}
+
+func (p *gcpProvider) Name() string {
+	return string(GCP)
+}
+
+func (p *gcpProvider) Schedule() (time.Duration, time.Duration) {
+	return p.conf.refreshInterval, p.conf.ttl
+}
+
+func (p *gcpProvider) Sources(ctx context.Context) ([]Source, error) {
+	var sources []Source
+	for _, project := range p.conf.projects {
+		// all zones are a source fetched by a aggregated list.
+		if project.allZones {
+			sources = append(sources, &gcpSource{project: project, naming: &p.conf.naming})
+			continue
+		}
+		for _, zone := range project.zones {
+			sources = append(sources, &gcpSource{project: project, zone: zone, naming: &p.conf.naming})
+		}
+	}
+	return sources, nil
+}
+
+// gcpSource is a zone of a project, or all zones of a project when zone is empty.
+type gcpSource struct {
+	project *gcpProject
+	zone    string
+	naming  *naming
+}
+
+func (s *gcpSource) Name() string {
+	if s.zone == "" {
+		return s.project.projectId + "/" + gcpAllZones
+	}
+	return s.project.projectId + "/" + s.zone
+}
+
+func (s *gcpSource) Fetch(ctx context.Context) ([]*Entry, error) {
+	var entries []*Entry
+	projectId := s.project.projectId
+
+	if s.zone == "" {
+		gcpListCall := s.project.client.Instances.AggregatedList(projectId)
+		gcpListCall.Filter(gcpRunningFilter)
+		if err := gcpListCall.Pages(ctx, func(instances *compute.InstanceAggregatedList) error {
+			for scope, scoped := range instances.Items {
+				zone := strings.TrimPrefix(scope, "zones/")
+				for _, instance := range scoped.Instances {
+					if entry := gcpEntry(projectId, zone, s.naming, instance); entry != nil {
+						entries = append(entries, entry)
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+
+	gcpListCall := s.project.client.Instances.List(projectId, s.zone)
+	gcpListCall.Filter(gcpRunningFilter)
+	if err := gcpListCall.Pages(ctx, func(instances *compute.InstanceList) error {
+		for _, instance := range instances.Items {
+			if entry := gcpEntry(projectId, s.zone, s.naming, instance); entry != nil {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func gcpEntry(project, zone string, naming *naming, instance *compute.Instance) *Entry {
+	if len(instance.NetworkInterfaces) == 0 {
+		return nil
+	}
+
+	record := &Record{Vendor: GCP, ZoneOrRegion: zone, Project: project,
+		ID: strconv.FormatInt(int64(instance.Id), 10), Name: instance.Name, Tags: instance.Labels}
+	// a machine type is a url(ex: .../zones/us-central1-a/machineTypes/e2-medium)
+	if instance.MachineType != "" {
+		record.InstanceType = path.Base(instance.MachineType)
+	}
+	// a last start is a launch time, a creation time for instances never restarted.
+	for _, timestamp := range []string{instance.LastStartTimestamp, instance.CreationTimestamp} {
+		if launched, err := time.Parse(time.RFC3339, timestamp); err == nil {
+			record.LaunchTime = launched
+			break
+		}
+	}
+	// insert public ip
+	if len(instance.NetworkInterfaces[0].AccessConfigs) > 0 {
+		if value := net.ParseIP(instance.NetworkInterfaces[0].AccessConfigs[0].NatIP); value != nil {
+			record.PublicIP = value
+		}
+	}
+	// insert private ip
+	if value := net.ParseIP(instance.NetworkInterfaces[0].NetworkIP); value != nil {
+		record.PrivateIP = value
+	}
+	// insert a public hostname set as a ptr of a external ip and a zonal internal hostname
+	if len(instance.NetworkInterfaces[0].AccessConfigs) > 0 {
+		record.PublicDNS = strings.TrimSuffix(instance.NetworkInterfaces[0].AccessConfigs[0].PublicPtrDomainName, ".")
+	}
+	if instance.Name != "" && zone != "" && project != "" {
+		record.PrivateDNS = instance.Name + "." + zone + ".c." + project + ".internal"
+	}
+	// insert external ipv6
+	if len(instance.NetworkInterfaces[0].Ipv6AccessConfigs) > 0 {
+		if value := net.ParseIP(instance.NetworkInterfaces[0].Ipv6AccessConfigs[0].ExternalIpv6); value != nil {
+			record.PublicIPv6 = value
+		}
+	}
+	// insert internal ipv6
+	if value := net.ParseIP(instance.NetworkInterfaces[0].Ipv6Address); value != nil {
+		record.PrivateIPv6 = value
+	}
+
+	// insert services from labels(ex: dns-srv: http-tcp-8080)
+	record.Services = parseServices(record.Tags)
+
+	// register instance-id, name, names from templates and labels(ex: web.role.tag)
+	entry := &Entry{Record: record, Names: []string{record.ID}}
+	naming.register(entry)
+
+	// register names scoped to a project(ex: web.my-project)
+	if project != "" {
+		for _, name := range entry.Names {
+			entry.add(name+"."+project, entry.origin(name)+"."+project)
+		}
+	}
+	return entry
+}
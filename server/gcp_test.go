@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"google.golang.org/api/option"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// fakeCompute is a compute-engine endpoint serving instances split into pages.
+type fakeCompute struct {
+	sync.Mutex
+	project string
+	pages   map[string][][]*compute.Instance // map[zone]pages
+	paths   []string
+	filters []string
+}
+
+func (f *fakeCompute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.paths = append(f.paths, r.URL.Path)
+	f.filters = append(f.filters, r.URL.Query().Get("filter"))
+
+	page := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+
+	var body interface{}
+	seps := strings.Split(strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "projects/"), "/")
+	switch {
+	case len(seps) == 3 && seps[0] == f.project && seps[1] == "aggregated" && seps[2] == "instances":
+		list := &compute.InstanceAggregatedList{Items: make(map[string]compute.InstancesScopedList)}
+		more := false
+		for zone, pages := range f.pages {
+			if page < len(pages) {
+				list.Items["zones/"+zone] = compute.InstancesScopedList{Instances: pages[page]}
+			}
+			if page+1 < len(pages) {
+				more = true
+			}
+		}
+		if more {
+			list.NextPageToken = strconv.Itoa(page + 1)
+		}
+		body = list
+	case len(seps) == 4 && seps[0] == f.project && seps[1] == "zones" && seps[3] == "instances":
+		pages, ok := f.pages[seps[2]]
+		if !ok || (len(pages) > 0 && page >= len(pages)) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		list := &compute.InstanceList{}
+		if len(pages) > 0 {
+			list.Items = pages[page]
+		}
+		if page+1 < len(pages) {
+			list.NextPageToken = strconv.Itoa(page + 1)
+		}
+		body = list
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func newFakeComputeClient(t *testing.T, ts *httptest.Server) *compute.Service {
+	client, err := compute.NewService(context.Background(), option.WithEndpoint(ts.URL+"/"), option.WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func fakeGcpInstance(id uint64, name, publicIP, privateIP string) *compute.Instance {
+	return &compute.Instance{
+		Id:                id,
+		Name:              name,
+		MachineType:       "https://www.googleapis.com/compute/v1/projects/fake-project/zones/fake-zone/machineTypes/e2-medium",
+		CreationTimestamp: "2020-01-02T03:04:05.000-07:00",
+		NetworkInterfaces: []*compute.NetworkInterface{
+			{NetworkIP: privateIP, AccessConfigs: []*compute.AccessConfig{{NatIP: publicIP}}},
+		},
+	}
+}
+
+func dualStack(instance *compute.Instance, external, internal string) *compute.Instance {
+	instance.NetworkInterfaces[0].Ipv6AccessConfigs = []*compute.AccessConfig{{ExternalIpv6: external}}
+	instance.NetworkInterfaces[0].Ipv6Address = internal
+	return instance
+}
+
+func labeled(instance *compute.Instance, labels map[string]string) *compute.Instance {
+	instance.Labels = labels
+	return instance
+}
+
+func TestGcpProvider_Fetch(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeCompute{project: "fake-project", pages: map[string][][]*compute.Instance{
+		"fake-zone-a": {
+			{fakeGcpInstance(1, "web", "1.1.1.1", "10.0.0.1"), fakeGcpInstance(2, "web", "1.1.1.2", "10.0.0.2")},
+			{dualStack(fakeGcpInstance(3, "db", "1.1.1.3", "10.0.0.3"), "2001:db8::3", "fd20::3")},
+		},
+		"fake-zone-b": {
+			{labeled(fakeGcpInstance(4, "batch", "1.1.1.4", "10.0.0.4"), map[string]string{"role": "worker", "env": "prod"})},
+			{fakeGcpInstance(5, "batch", "1.1.1.5", "10.0.0.5")},
+			{{Id: 6, Name: "no-network"}},
+		},
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	client := newFakeComputeClient(t, ts)
+
+	tests := map[string]struct {
+		conf     *GcpConfig
+		requests int
+		sources  []string
+	}{
+		"zones": {conf: &GcpConfig{projects: []*gcpProject{{projectId: "fake-project", zones: []string{"fake-zone-a", "fake-zone-b"}}},
+			naming: naming{indexTags: []string{"role"}}}, requests: 5,
+			sources: []string{"fake-project/fake-zone-a", "fake-project/fake-zone-b"}},
+		"allZones": {conf: &GcpConfig{projects: []*gcpProject{{projectId: "fake-project", allZones: true}},
+			naming: naming{indexTags: []string{"role"}}}, requests: 3,
+			sources: []string{"fake-project/all"}},
+	}
+
+	for _, t := range tests {
+		fake.paths = nil
+		fake.filters = nil
+		t.conf.projects[0].client = client
+
+		sources, err := NewGcpProvider(t.conf).Sources(context.Background())
+		assert.NoError(err)
+		var names []string
+		for _, source := range sources {
+			names = append(names, source.Name())
+		}
+		assert.Equal(t.sources, names)
+
+		entries, err := fetchAll(NewGcpProvider(t.conf))
+		assert.NoError(err)
+		assert.Len(entries, 5)
+		assert.Len(fake.paths, t.requests)
+		for _, filter := range fake.filters {
+			assert.Equal(gcpRunningFilter, filter)
+		}
+
+		table := merge(entries)
+		assert.Len(table["web"], 2)
+		assert.Len(table["db"], 1)
+		assert.Len(table["batch"], 2)
+		assert.Len(table["no-network"], 0)
+		assert.Len(table["5"], 1)
+		assert.Equal("1.1.1.5", table["5"][0].PublicIP.String())
+		assert.Equal("10.0.0.5", table["5"][0].PrivateIP.String())
+		assert.Equal("fake-zone-b", table["5"][0].ZoneOrRegion)
+		assert.Equal(GCP, table["5"][0].Vendor)
+		assert.Equal("fake-project", table["5"][0].Project)
+		assert.Len(table["batch.fake-project"], 2)
+		assert.Equal("2001:db8::3", table["3"][0].PublicIPv6.String())
+		assert.Equal("fd20::3", table["3"][0].PrivateIPv6.String())
+		assert.Nil(table["5"][0].PublicIPv6)
+		assert.Len(table["worker.role.tag"], 1)
+		assert.Equal("e2-medium", table["5"][0].InstanceType)
+		assert.Equal("2020-01-02T10:04:05Z", table["5"][0].LaunchTime.UTC().Format(time.RFC3339))
+		assert.Equal("5", table["5"][0].ID)
+		assert.Equal("batch.fake-zone-b.c.fake-project.internal", table["5"][0].PrivateDNS)
+		assert.Equal("", table["5"][0].PublicDNS)
+		assert.Len(table["prod.env.tag"], 0)
+		assert.Equal("worker", table["4"][0].Tags["role"])
+	}
+
+	// unknown zone must fail a fetch
+	_, err := fetchAll(NewGcpProvider(&GcpConfig{projects: []*gcpProject{{projectId: "fake-project", zones: []string{"unknown"},
+		client: client}}}))
+	assert.Error(err)
+}
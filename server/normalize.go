@@ -0,0 +1,92 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/logrusorgru/aurora"
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxLabelLength = 63
+)
+
+// normalizeLabel converts a raw value such as a Name tag into a single LDH label(RFC 1123).
+// letters are lowered, characters other than letters, digits and hyphens(including dots) become a hyphen,
+// repeated hyphens are folded and hyphens at both ends are trimmed.
+// non-ASCII characters are encoded to punycode(xn--) when idn is true, or become a hyphen.
+// a label is cut to 63 characters, except punycode which is dropped for a ascii label instead.
+func normalizeLabel(raw string, idn bool) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(raw) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || (idn && r >= utf8.RuneSelf):
+			b.WriteRune(r)
+			hyphen = false
+		case !hyphen:
+			b.WriteRune('-')
+			hyphen = true
+		}
+	}
+	label := strings.Trim(b.String(), "-")
+
+	if idn && label != "" {
+		ascii, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return normalizeLabel(raw, false)
+		}
+		// cutting punycode breaks its encoding, so a long one falls back to a ascii label.
+		if len(ascii) > maxLabelLength {
+			log.Printf("%s idna label of %s is longer than %d\n", aurora.Red("[idna]"), aurora.Magenta(raw), maxLabelLength)
+			return normalizeLabel(raw, false)
+		}
+		label = ascii
+	}
+	if len(label) > maxLabelLength {
+		label = strings.TrimRight(label[:maxLabelLength], "-")
+	}
+	return label
+}
+
+// normalizeName converts a raw name having several labels such as a name from a template.
+// labels are normalized one by one, a name having an empty label is empty.
+func normalizeName(raw string, idn bool) string {
+	labels := strings.Split(raw, ".")
+	for i, label := range labels {
+		labels[i] = normalizeLabel(label, idn)
+		if labels[i] == "" {
+			return ""
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// collisions returns names which different raw names are normalized to, with the raw names.
+func collisions(entries []*Entry) map[string][]string {
+	origins := make(map[string]map[string]bool)
+	for _, entry := range entries {
+		for _, name := range entry.Names {
+			key := strings.ToLower(name)
+			if origins[key] == nil {
+				origins[key] = make(map[string]bool)
+			}
+			origins[key][strings.ToLower(entry.origin(name))] = true
+		}
+	}
+
+	found := make(map[string][]string)
+	for key, raws := range origins {
+		if len(raws) < 2 {
+			continue
+		}
+		for raw := range raws {
+			found[key] = append(found[key], raw)
+		}
+		sort.Strings(found[key])
+	}
+	return found
+}
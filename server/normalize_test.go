@@ -0,0 +1,68 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]struct {
+		raw   string
+		idn   bool
+		label string
+	}{
+		"ldh":        {raw: "web-1", label: "web-1"},
+		"upper":      {raw: "Web", label: "web"},
+		"space":      {raw: "web server", label: "web-server"},
+		"underscore": {raw: "web_server", label: "web-server"},
+		"dot":        {raw: "web.aws", label: "web-aws"},
+		"repeat":     {raw: "web -- _server", label: "web-server"},
+		"trim":       {raw: " -web- ", label: "web"},
+		"empty":      {raw: "___", label: ""},
+		"nonASCII":   {raw: "웹서버", label: ""},
+		"mixed":      {raw: "web 웹", label: "web"},
+		"idn":        {raw: "웹서버", idn: true, label: "xn--hk3b17fw2f"},
+		"idnMixed":   {raw: "Café Web", idn: true, label: "xn--caf-web-dya"},
+		"long":       {raw: strings.Repeat("a", 70), label: strings.Repeat("a", 63)},
+		"idnLong":    {raw: "web 가나다라마바사아자차카타파하거너더러머버서어저처커터퍼허", idn: true, label: "web"},
+	}
+	for _, t := range tests {
+		assert.Equal(t.label, normalizeLabel(t.raw, t.idn), t.raw)
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("api.prod", normalizeName("api.prod", false))
+	assert.Equal("my-api.prod", normalizeName("My API.Prod", false))
+	assert.Equal("", normalizeName("api.", false))
+	assert.Equal("", normalizeName(".prod", false))
+	assert.Equal("", normalizeName("api..prod", false))
+}
+
+func TestCollisions(t *testing.T) {
+	assert := assert.New(t)
+
+	web1 := &Entry{Record: &Record{Name: "web_1"}}
+	(&naming{}).register(web1)
+	web2 := &Entry{Record: &Record{Name: "web 1"}}
+	(&naming{}).register(web2)
+	web3 := &Entry{Record: &Record{Name: "web-1"}}
+	(&naming{}).register(web3)
+	same := &Entry{Record: &Record{Name: "Web_1"}}
+	(&naming{}).register(same)
+	db := &Entry{Record: &Record{Name: "db"}}
+	(&naming{}).register(db)
+
+	found := collisions([]*Entry{web1, web2, web3, same, db})
+	assert.Len(found, 1)
+	assert.Equal([]string{"web 1", "web-1", "web_1"}, found["web-1"])
+
+	// a same raw name of several instances is not a collision
+	assert.Len(collisions([]*Entry{web1, same, db}), 0)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+const (
+	dnsTag = "tag"
+)
+
+// Entry is a record with the names it should be indexed under.
+type Entry struct {
+	Record  *Record
+	Names   []string
+	Origins map[string]string `json:",omitempty"` // map[name]raw name, for names changed by normalization
+}
+
+// add appends a name normalized from a raw name, an empty name is skipped.
+func (e *Entry) add(name, raw string) {
+	if name == "" {
+		return
+	}
+	e.Names = append(e.Names, name)
+	if name != raw {
+		if e.Origins == nil {
+			e.Origins = make(map[string]string)
+		}
+		e.Origins[name] = raw
+	}
+}
+
+// origin returns a raw name of a name.
+func (e *Entry) origin(name string) string {
+	if raw, ok := e.Origins[name]; ok {
+		return raw
+	}
+	return name
+}
+
+// InstanceProvider is a provider of running instances split into sources.
+// the store refreshes every source on its own and merges entries of all sources into one lookup table.
+type InstanceProvider interface {
+	Name() string
+	Sources(ctx context.Context) ([]Source, error)
+}
+
+// Source is a unit of fetching instances such as a region of an account or a zone of a project.
+// a failed source keeps its last-known entries marked stale.
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]*Entry, error)
+}
+
+// failedSource is a source which couldn't be listed(ex: a region discovery of an account failed).
+// it fails every fetch, so last-known entries of sources below it are kept stale.
+type failedSource struct {
+	name string
+	err  error
+}
+
+func (s *failedSource) Name() string {
+	return s.name
+}
+
+func (s *failedSource) Fetch(ctx context.Context) ([]*Entry, error) {
+	return nil, s.err
+}
+
+// Scheduler is implemented by providers having own refresh interval and ttl.
+// zero values mean common ones.
+type Scheduler interface {
+	Schedule() (refreshInterval, ttl time.Duration)
+}
+
+// NewProviders returns providers for the enabled clouds.
+func NewProviders(awsconf *AwsConfig, gcpconf *GcpConfig) []InstanceProvider {
+	var providers []InstanceProvider
+	if awsconf != nil {
+		providers = append(providers, NewAwsProvider(awsconf))
+	}
+	if gcpconf != nil {
+		providers = append(providers, NewGcpProvider(gcpconf))
+	}
+	return providers
+}
+
+// naming is how records of a provider are indexed besides instance ids.
+type naming struct {
+	indexTags []string             // tag(label) keys indexed as value.key.tag
+	templates []*template.Template // names generated from a record(ex: {{.Tags.service}}-{{.Tags.env}})
+	replace   bool                 // generated names replace a raw name such as a Name tag
+	idn       bool                 // non-ASCII names are encoded to punycode
+}
+
+// register adds a raw name, names generated from templates, a canonical name and names of tags to an entry.
+// a raw name and tag values become a single label, a template failing on a record(ex: a missing tag) is skipped.
+func (n *naming) register(entry *Entry) {
+	if n == nil {
+		n = &naming{}
+	}
+	record := entry.Record
+
+	if !n.replace {
+		entry.add(normalizeLabel(record.Name, n.idn), record.Name)
+	}
+	// a tag normalized to empty is missing for templates, otherwise a name is silently cut(ex: api- -> api).
+	templated := record
+	if len(n.templates) > 0 {
+		copied := *record
+		copied.Tags = make(map[string]string, len(record.Tags))
+		for key, value := range record.Tags {
+			if normalizeLabel(value, n.idn) != "" {
+				copied.Tags[key] = value
+			}
+		}
+		templated = &copied
+	}
+	for _, tmpl := range n.templates {
+		var name strings.Builder
+		if err := tmpl.Execute(&name, templated); err != nil {
+			continue
+		}
+		// a name ending with a label of usage(ex: api.public) is unreachable, because the label is read as usage.
+		normalized := normalizeName(name.String(), n.idn)
+		if labels := strings.Split(normalized, "."); len(labels) > 1 && isUsageLabel(labels[len(labels)-1]) {
+			log.Printf("%s name %s ends with a reserved label\n", aurora.Red("[skip]"), aurora.Magenta(normalized))
+			continue
+		}
+		entry.add(normalized, name.String())
+	}
+
+	// a canonical name is unique per instance(ex: web.i-0abc), it is answered to PTR queries.
+	if record.ID != "" {
+		record.Canonical = strings.ToLower(record.ID)
+		if name := normalizeLabel(record.Name, n.idn); name != "" {
+			record.Canonical = name + "." + record.Canonical
+		}
+		entry.add(record.Canonical, record.Canonical)
+	}
+
+	// tags indexed under keys(ex: web.role.tag), a key is case-insensitive.
+	if len(record.Tags) == 0 || len(n.indexTags) == 0 {
+		return
+	}
+	lowered := make(map[string]string, len(record.Tags))
+	for key, value := range record.Tags {
+		lowered[strings.ToLower(key)] = value
+	}
+	for _, key := range n.indexTags {
+		value := normalizeLabel(lowered[strings.ToLower(key)], n.idn)
+		if value == "" {
+			continue
+		}
+		entry.add(value+"."+normalizeLabel(key, n.idn)+"."+dnsTag, lowered[strings.ToLower(key)]+"."+key+"."+dnsTag)
+	}
+}
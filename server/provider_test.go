@@ -0,0 +1,356 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider has a single source returning entries.
+type fakeProvider struct {
+	name       string
+	entries    []*Entry
+	err        error // error of a source
+	sourcesErr error // error of a provider
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) Sources(ctx context.Context) ([]Source, error) {
+	if p.sourcesErr != nil {
+		return nil, p.sourcesErr
+	}
+	return []Source{p}, nil
+}
+
+func (p *fakeProvider) Fetch(ctx context.Context) ([]*Entry, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	// entries are fetched newly like a cloud api.
+	var entries []*Entry
+	for _, entry := range p.entries {
+		record := *entry.Record
+		entries = append(entries, &Entry{Record: &record, Names: entry.Names, Origins: entry.Origins})
+	}
+	return entries, nil
+}
+
+// slowProvider has sources taking a delay, a hung source waits for a deadline.
+type slowProvider struct {
+	count      int
+	delay      time.Duration
+	hung       int
+	running    int32
+	maxRunning int32
+}
+
+type slowSource struct {
+	provider *slowProvider
+	index    int
+}
+
+func (p *slowProvider) Name() string {
+	return "SLOW"
+}
+
+func (p *slowProvider) Sources(ctx context.Context) ([]Source, error) {
+	var sources []Source
+	for i := 0; i < p.count; i++ {
+		sources = append(sources, &slowSource{provider: p, index: i})
+	}
+	return sources, nil
+}
+
+func (s *slowSource) Name() string {
+	return fmt.Sprintf("%d", s.index)
+}
+
+func (s *slowSource) Fetch(ctx context.Context) ([]*Entry, error) {
+	running := atomic.AddInt32(&s.provider.running, 1)
+	defer atomic.AddInt32(&s.provider.running, -1)
+	for {
+		max := atomic.LoadInt32(&s.provider.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(&s.provider.maxRunning, max, running) {
+			break
+		}
+	}
+
+	if s.index == s.provider.hung {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	select {
+	case <-time.After(s.provider.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []*Entry{{Record: &Record{Vendor: UNKNOWN}, Names: []string{"slow", s.Name()}}}, nil
+}
+
+// fetchAll returns entries of every sources of a provider.
+func fetchAll(provider InstanceProvider) ([]*Entry, error) {
+	sources, err := provider.Sources(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, source := range sources {
+		fetched, err := source.Fetch(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fetched...)
+	}
+	return entries, nil
+}
+
+func TestNewProviders(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Len(NewProviders(nil, nil), 0)
+	assert.Len(NewProviders(&AwsConfig{}, nil), 1)
+	assert.Len(NewProviders(nil, &GcpConfig{}), 1)
+
+	providers := NewProviders(&AwsConfig{}, &GcpConfig{})
+	assert.Len(providers, 2)
+	assert.Equal(string(AWS), providers[0].Name())
+	assert.Equal(string(GCP), providers[1].Name())
+}
+
+func TestNaming_register(t *testing.T) {
+	assert := assert.New(t)
+
+	n, err := parseNaming(map[interface{}]interface{}{
+		"index_tags":     []interface{}{"role", "Team"},
+		"name_templates": []interface{}{"{{.Tags.service}}-{{.Tags.env}}", "{{.Tags.service}}.{{.Tags.env}}", "{{.Tags.env}}.{{.Account}}"},
+	}, "index_tags")
+	assert.NoError(err)
+
+	tests := map[string]struct {
+		naming *naming
+		record *Record
+		names  []string
+	}{
+		"nil":       {naming: nil, record: &Record{ID: "i-1", Name: "web"}, names: []string{"i-1", "web", "web.i-1"}},
+		"normalize": {naming: nil, record: &Record{ID: "i-1", Name: "Web Server_1.aws"}, names: []string{"i-1", "web-server-1-aws", "web-server-1-aws.i-1"}},
+		"append": {naming: &n, record: &Record{ID: "i-1", Name: "web", Account: "prod", Tags: map[string]string{"service": "api", "env": "prod", "role": "front_end", "team": "Core"}},
+			names: []string{"i-1", "web", "api-prod", "api.prod", "prod.prod", "web.i-1", "front-end.role.tag", "core.team.tag"}},
+		"missing": {naming: &n, record: &Record{ID: "i-1", Name: "web", Tags: map[string]string{"service": "api"}}, names: []string{"i-1", "web", "web.i-1"}},
+		"noTags":  {naming: &n, record: &Record{ID: "i-1", Name: "web"}, names: []string{"i-1", "web", "web.i-1"}},
+		"empty":   {naming: &n, record: &Record{ID: "i-1", Name: "web", Tags: map[string]string{"service": "api", "env": ""}}, names: []string{"i-1", "web", "web.i-1"}},
+		"blank":   {naming: &n, record: &Record{ID: "i-1", Name: "web", Tags: map[string]string{"service": "api", "env": "__"}}, names: []string{"i-1", "web", "web.i-1"}},
+		"reserved": {naming: &n, record: &Record{ID: "i-1", Name: "web", Account: "prod", Tags: map[string]string{"service": "api", "env": "public"}},
+			names: []string{"i-1", "web", "api-public", "public.prod", "web.i-1"}},
+		"replace": {naming: &naming{templates: n.templates, replace: true}, record: &Record{ID: "i-1", Name: "web", Tags: map[string]string{"service": "api", "env": "dev"}},
+			names: []string{"i-1", "api-dev", "api.dev", "web.i-1"}},
+	}
+	for _, t := range tests {
+		entry := &Entry{Record: t.record, Names: []string{t.record.ID}}
+		t.naming.register(entry)
+		assert.Equal(t.names, entry.Names)
+		assert.Contains(t.names, entry.Record.Canonical)
+	}
+
+	// raw names changed by normalization are kept
+	entry := &Entry{Record: &Record{Name: "Web_1"}}
+	(&naming{indexTags: []string{"role"}}).register(entry)
+	assert.Equal([]string{"web-1"}, entry.Names)
+	assert.Equal("Web_1", entry.origin("web-1"))
+	assert.Equal("i-1", entry.origin("i-1"))
+	assert.Empty(entry.Record.Canonical)
+}
+
+func TestMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	web1 := &Record{Vendor: AWS, PublicIP: net.ParseIP("1.1.1.1")}
+	web2 := &Record{Vendor: GCP, PublicIP: net.ParseIP("2.2.2.2")}
+	db := &Record{Vendor: AWS, PublicIP: net.ParseIP("3.3.3.3")}
+
+	table := merge([]*Entry{
+		{Record: web1, Names: []string{"i-1", "Web"}},
+		{Record: web2, Names: []string{"100", "web"}},
+		{Record: db, Names: []string{"i-2", "db", ""}},
+	})
+
+	assert.Len(table, 5)
+	assert.ElementsMatch([]*Record{web1, web2}, table["web"])
+	assert.Equal([]*Record{web1}, table["i-1"])
+	assert.Equal([]*Record{web2}, table["100"])
+	assert.Equal([]*Record{db}, table["db"])
+
+	// a order must be same regardless of entries order
+	again := merge([]*Entry{
+		{Record: web2, Names: []string{"web"}},
+		{Record: web1, Names: []string{"web"}},
+	})
+	assert.Equal(table["web"], again["web"])
+}
+
+func TestStore_renewal(t *testing.T) {
+	assert := assert.New(t)
+
+	aws := &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS}, Names: []string{"i-1", "web"}},
+	}}
+	gcp := &fakeProvider{name: string(GCP), entries: []*Entry{
+		{Record: &Record{Vendor: GCP}, Names: []string{"100", "web"}},
+	}}
+
+	store, err := NewStore(nil, aws, gcp)
+	assert.NoError(err)
+
+	records, err := store.Lookup("web")
+	assert.NoError(err)
+	assert.Len(records, 2)
+	for _, record := range records {
+		assert.False(record.Stale)
+		// a ttl doesn't outlive a next refresh
+		assert.True(record.TTL() <= defaultRefreshInterval)
+		assert.True(record.TTL() > defaultRefreshInterval-10*time.Second)
+	}
+
+	records, err = store.Lookup("100")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.Equal(GCP, records[0].Vendor)
+
+	// a failed source keeps last-known records marked stale
+	gcp.err = fmt.Errorf("[err] fake")
+	aws.entries = append(aws.entries, &Entry{Record: &Record{Vendor: AWS}, Names: []string{"i-2", "web"}})
+	assert.NoError(store.renewal())
+	records, err = store.Lookup("web")
+	assert.NoError(err)
+	assert.Len(records, 3)
+	records, err = store.Lookup("100")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.True(records[0].Stale)
+	records, err = store.Lookup("i-2")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.False(records[0].Stale)
+
+	statuses := store.Status()
+	assert.Len(statuses, 2)
+	assert.Equal("AWS/AWS", statuses[0].Name)
+	assert.False(statuses[0].Stale)
+	assert.Equal(2, statuses[0].Records)
+	assert.Equal("GCP/GCP", statuses[1].Name)
+	assert.True(statuses[1].Stale)
+	assert.Error(statuses[1].Err)
+	assert.Equal(1, statuses[1].Records)
+
+	// a failed provider keeps last-known records of its sources
+	gcp.err = nil
+	gcp.sourcesErr = fmt.Errorf("[err] fake")
+	assert.NoError(store.renewal())
+	records, err = store.Lookup("100")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.True(records[0].Stale)
+
+	// a recovered source is not stale
+	gcp.sourcesErr = nil
+	assert.NoError(store.renewal())
+	records, err = store.Lookup("100")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.False(records[0].Stale)
+
+	// every sources failed
+	aws.err = fmt.Errorf("[err] fake")
+	gcp.err = fmt.Errorf("[err] fake")
+	assert.Error(store.renewal())
+	records, err = store.Lookup("web")
+	assert.NoError(err)
+	assert.Len(records, 3)
+	for _, record := range records {
+		assert.True(record.Stale)
+	}
+
+	_, err = NewStore(nil, aws, gcp)
+	assert.Error(err)
+}
+
+func TestStore_renewalConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	slow := &slowProvider{count: 6, delay: 50 * time.Millisecond, hung: 0}
+	start := time.Now()
+	store, err := NewStore(&CommonConfig{concurrency: 2, timeout: 300 * time.Millisecond}, slow)
+	assert.NoError(err)
+
+	// a hung source is cut by a timeout and doesn't hold back others.
+	assert.True(time.Since(start) < 2*time.Second)
+	assert.Equal(int32(2), slow.maxRunning)
+
+	records, err := store.Lookup("slow")
+	assert.NoError(err)
+	assert.Len(records, 5)
+
+	statuses := store.Status()
+	assert.Len(statuses, 6)
+	assert.Equal("SLOW/0", statuses[0].Name)
+	assert.True(statuses[0].Stale)
+	assert.Equal(context.DeadlineExceeded, statuses[0].Err)
+	for _, status := range statuses[1:] {
+		assert.False(status.Stale)
+	}
+}
+
+// scheduledProvider has own refresh interval and ttl.
+type scheduledProvider struct {
+	fakeProvider
+	refresh time.Duration
+	ttl     time.Duration
+}
+
+func (p *scheduledProvider) Schedule() (time.Duration, time.Duration) {
+	return p.refresh, p.ttl
+}
+
+func TestStore_schedule(t *testing.T) {
+	assert := assert.New(t)
+
+	entries := []*Entry{{Record: &Record{}, Names: []string{"web"}}}
+	short := &scheduledProvider{fakeProvider: fakeProvider{name: "SHORT", entries: entries}, ttl: 20 * time.Second}
+	long := &scheduledProvider{fakeProvider: fakeProvider{name: "LONG", entries: entries}, refresh: time.Hour, ttl: 30 * time.Minute}
+	common := &fakeProvider{name: "COMMON", entries: entries}
+
+	store, err := NewStore(&CommonConfig{refreshInterval: 10 * time.Minute, ttl: 15 * time.Minute, minTTL: 3 * time.Second}, short, long, common)
+	assert.NoError(err)
+
+	refresh, ttl := store.schedule(short)
+	assert.Equal(10*time.Minute, refresh)
+	assert.Equal(20*time.Second, ttl)
+	refresh, ttl = store.schedule(long)
+	assert.Equal(time.Hour, refresh)
+	assert.Equal(30*time.Minute, ttl)
+	refresh, ttl = store.schedule(common)
+	assert.Equal(10*time.Minute, refresh)
+	assert.Equal(15*time.Minute, ttl)
+
+	records, err := store.Lookup("web")
+	assert.NoError(err)
+	assert.Len(records, 3)
+	ttls := map[time.Duration]bool{}
+	for _, record := range records {
+		// a ttl is the smaller of a ttl and a refresh interval
+		ttls[record.TTL().Round(time.Minute)] = true
+	}
+	assert.Equal(map[time.Duration]bool{0: true, 30 * time.Minute: true, 10 * time.Minute: true}, ttls)
+
+	// a minimum ttl after a next refresh is missed
+	expired := &Record{ExpiredAt: time.Now().Add(-time.Minute), minTTL: 3 * time.Second}
+	assert.Equal(3*time.Second, expired.TTL())
+	assert.Equal(defaultMinTTL, (&Record{}).TTL())
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	reverseV4Suffix = ".in-addr.arpa."
+	reverseV6Suffix = ".ip6.arpa."
+)
+
+// reverseIndex builds a reverse table indexing every record having a canonical name under its ips.
+func reverseIndex(entries []*Entry) LookupTable {
+	table := make(LookupTable)
+	for _, entry := range entries {
+		record := entry.Record
+		if record.Canonical == "" {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, ip := range []net.IP{record.PublicIP, record.PrivateIP, record.PublicIPv6, record.PrivateIPv6} {
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			table[ip.String()] = append(table[ip.String()], record)
+		}
+	}
+
+	// a order must be same regardless of entries order
+	for _, v := range table {
+		sort.Slice(v, func(i, j int) bool {
+			return v[i].Canonical < v[j].Canonical
+		})
+	}
+	return table
+}
+
+// reverseIP returns an ip of a reverse name(ex: 4.3.2.1.in-addr.arpa.), nil when a name is not a host.
+func reverseIP(name string) net.IP {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, reverseV4Suffix):
+		labels := strings.Split(strings.TrimSuffix(name, reverseV4Suffix), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		octets := make([]string, 0, net.IPv4len)
+		for i := len(labels) - 1; i >= 0; i-- {
+			if _, err := strconv.ParseUint(labels[i], 10, 8); err != nil {
+				return nil
+			}
+			octets = append(octets, labels[i])
+		}
+		return net.ParseIP(strings.Join(octets, ".")).To4()
+	case strings.HasSuffix(name, reverseV6Suffix):
+		labels := strings.Split(strings.TrimSuffix(name, reverseV6Suffix), ".")
+		if len(labels) != net.IPv6len*2 {
+			return nil
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, label := range labels {
+			nibble, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil
+			}
+			// labels are nibbles from a last one
+			pos := len(labels) - 1 - i
+			ip[pos/2] |= byte(nibble) << uint(4*(1-pos%2))
+		}
+		return ip
+	}
+	return nil
+}
+
+// isReverseZone checks a zone is a reverse zone of ipv4 or ipv6.
+func isReverseZone(zone string) bool {
+	zone = "." + strings.ToLower(zone)
+	return strings.HasSuffix(zone, reverseV4Suffix) || strings.HasSuffix(zone, reverseV6Suffix)
+}
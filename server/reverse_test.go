@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseIP(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]struct {
+		name string
+		ip   string
+	}{
+		"ipv4":        {name: "4.3.2.10.in-addr.arpa.", ip: "10.2.3.4"},
+		"ipv4Upper":   {name: "4.3.2.10.IN-ADDR.ARPA.", ip: "10.2.3.4"},
+		"ipv4Network": {name: "3.2.10.in-addr.arpa.", ip: "<nil>"},
+		"ipv4Invalid": {name: "256.3.2.10.in-addr.arpa.", ip: "<nil>"},
+		"ipv6":        {name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", ip: "2001:db8::1"},
+		"ipv6Network": {name: "8.b.d.0.1.0.0.2.ip6.arpa.", ip: "<nil>"},
+		"ipv6Invalid": {name: "g.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", ip: "<nil>"},
+		"forward":     {name: "web.example.com.", ip: "<nil>"},
+	}
+	for _, t := range tests {
+		assert.Equal(t.ip, reverseIP(t.name).String(), t.name)
+	}
+}
+
+func TestReverseIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	web := &Record{Canonical: "web.i-1", PublicIP: net.ParseIP("1.1.1.1"), PrivateIP: net.ParseIP("10.0.0.1"), PublicIPv6: net.ParseIP("2001:db8::1"), PrivateIPv6: net.ParseIP("2001:db8::1")}
+	db := &Record{Canonical: "db.i-2", PrivateIP: net.ParseIP("10.0.0.1")}
+	unknown := &Record{PublicIP: net.ParseIP("1.1.1.3")}
+
+	table := reverseIndex([]*Entry{{Record: web}, {Record: db}, {Record: unknown}})
+	assert.Len(table, 3)
+	assert.Equal([]*Record{web}, table["1.1.1.1"])
+	assert.Equal([]*Record{db, web}, table["10.0.0.1"])
+	assert.Equal([]*Record{web}, table["2001:db8::1"])
+	assert.Len(table["1.1.1.3"], 0)
+}
+
+func TestIsReverseZone(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isReverseZone("10.in-addr.arpa."))
+	assert.True(isReverseZone("in-addr.arpa."))
+	assert.True(isReverseZone("8.b.d.0.1.0.0.2.IP6.ARPA."))
+	assert.False(isReverseZone("example.com."))
+	assert.False(isReverseZone("fake-in-addr.arpa."))
+}
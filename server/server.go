@@ -17,7 +17,10 @@ import (
 )
 
 const (
-	dnsRR = "rr"
+	dnsRR      = "rr"
+	dnsCname   = "cname"
+	dnsPrivate = "private"
+	dnsPublic  = "public"
 )
 
 type Server interface {
@@ -31,34 +34,56 @@ type server struct {
 }
 
 func (s *server) Start() {
-	udpServer := &dns.Server{Addr: ":" + s.config.port, Net: "udp"}
-	go func() {
-		if err := udpServer.ListenAndServe(); err != nil {
-			log.Panic(err)
-		}
-	}()
-	tcpServer := &dns.Server{Addr: ":" + s.config.port, Net: "tcp"}
-	mode := "PUBLIC-IP"
-	if s.config.private {
-		mode = "PRIVATE-IP"
-	}
-	log.Printf("%s listen(%s) nameserver(%s) domain(%s) Serving %s\n",
-		aurora.Green("[start]"),
-		aurora.Blue(fmt.Sprintf("%s:%s", s.publicIP, s.config.port)),
-		aurora.Yellow(s.config.nameserver),
-		aurora.Cyan(s.config.domain),
-		aurora.Magenta(mode),
-	)
-	if err := tcpServer.ListenAndServe(); err != nil {
-		log.Panic(err)
+	// listen on each address, views can match a address receiving queries.
+	hosts := s.config.listens
+	if len(hosts) == 0 {
+		hosts = []string{""}
 	}
+	for _, host := range hosts {
+		for _, network := range []string{"udp", "tcp"} {
+			dnsServer := &dns.Server{Addr: net.JoinHostPort(host, s.config.port), Net: network}
+			go func() {
+				if err := dnsServer.ListenAndServe(); err != nil {
+					log.Panic(err)
+				}
+			}()
+		}
+	}
+
+	for _, zone := range s.config.allZones() {
+		mode := "PUBLIC-IP"
+		if zone.private {
+			mode = "PRIVATE-IP"
+		}
+		log.Printf("%s listen(%s) nameserver(%s) domain(%s) Serving %s\n",
+			aurora.Green("[start]"),
+			aurora.Blue(fmt.Sprintf("%s:%s", s.publicIP, s.config.port)),
+			aurora.Yellow(zone.nameserver),
+			aurora.Cyan(zone.domain),
+			aurora.Magenta(mode),
+		)
+	}
+	for _, view := range s.config.views {
+		mode := "PUBLIC-IP"
+		if view.private {
+			mode = "PRIVATE-IP"
+		}
+		log.Printf("%s view(%s) clients(%d) listeners(%d) Serving %s\n",
+			aurora.Green("[start]"), aurora.Cyan(view.name), len(view.clients), len(view.listeners), aurora.Magenta(mode))
+	}
+	select {}
 }
 
 func (s *server) Lookup(search string) ([]*Record, error) {
+	return s.lookup(search, nil)
+}
+
+// lookup returns records of a search served in a zone, a nil zone serves every records.
+func (s *server) lookup(search string, zone *zoneConfig) ([]*Record, error) {
 	search = strings.ToLower(search)
 	seps := strings.Split(search, ".")
 	if len(seps) == 1 {
-		return s.store.Lookup(seps[0])
+		return s.find(seps[0], zone)
 	}
 
 	prefix := seps[0]
@@ -71,7 +96,7 @@ func (s *server) Lookup(search string) ([]*Record, error) {
 
 	// if a suffix means round-robin, must be responsibility to return shuffle result
 	if suffix == dnsRR {
-		records, err := s.store.Lookup(strings.Join(seps[0:(len(seps)-1)], "."))
+		records, err := s.find(strings.Join(seps[0:(len(seps)-1)], "."), zone)
 		if err != nil {
 			return nil, err
 		}
@@ -88,6 +113,22 @@ func (s *server) Lookup(search string) ([]*Record, error) {
 		checkVendor = GCP
 	}
 
+	// a numeric first label is an index only when the full name doesn't resolve,
+	// so names that start with a number (ex: 3.version.tag, 123456.proj) stay reachable.
+	if num > 0 {
+		full := search
+		if checkVendor != UNKNOWN {
+			full = strings.Join(seps[0:(len(seps)-1)], ".")
+		}
+		allRecords, err := s.find(full, zone)
+		if err != nil {
+			return nil, err
+		}
+		if records := filterVendor(allRecords, checkVendor); len(records) > 0 {
+			return records, nil
+		}
+	}
+
 	var query string
 	if checkVendor != UNKNOWN && num > 0 { // if prefix is number and suffix is aws or gcp
 		if len(seps) == 2 {
@@ -103,21 +144,12 @@ func (s *server) Lookup(search string) ([]*Record, error) {
 		query = strings.Join(seps[0:(len(seps))], ".")
 	}
 
-	allRecords, err := s.store.Lookup(query)
+	allRecords, err := s.find(query, zone)
 	if err != nil {
 		return nil, err
 	}
 
-	var filter []*Record
-	if checkVendor != UNKNOWN {
-		for _, record := range allRecords {
-			if record.Vendor == checkVendor {
-				filter = append(filter, record)
-			}
-		}
-	} else {
-		filter = allRecords
-	}
+	filter := filterVendor(allRecords, checkVendor)
 
 	var records []*Record
 	if num > 0 {
@@ -130,77 +162,536 @@ func (s *server) Lookup(search string) ([]*Record, error) {
 	return records, nil
 }
 
+// filterVendor returns records belonging to vendor, or all records if vendor is UNKNOWN.
+func filterVendor(records []*Record, vendor CloudVendor) []*Record {
+	if vendor == UNKNOWN {
+		return records
+	}
+	var filter []*Record
+	for _, record := range records {
+		if record.Vendor == vendor {
+			filter = append(filter, record)
+		}
+	}
+	return filter
+}
+
+// find returns records of a key in a store served in a zone.
+func (s *server) find(key string, zone *zoneConfig) ([]*Record, error) {
+	records, err := s.store.Lookup(key)
+	if err != nil || zone == nil || len(zone.sources) == 0 {
+		return records, err
+	}
+	served := make([]*Record, 0, len(records))
+	for _, record := range records {
+		if zone.serves(record) {
+			served = append(served, record)
+		}
+	}
+	return served, nil
+}
+
 func (s *server) dnsRequest(w dns.ResponseWriter, r *dns.Msg) {
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Compress = false
 	m.Authoritative = true
 
+	stale, expired, dropped := false, false, false
+	zone, apex := &s.config.zoneConfig, s.config.domain
 	for _, msg := range m.Question {
+		z, a := s.zone(msg.Name)
+		if z == nil {
+			continue
+		}
+		zone, apex = z, a
+		reverse := apex != zone.domain
+		private := s.private(w, zone)
 		switch msg.Qtype {
 		case dns.TypeNS: // dns nameserver
-			if msg.Name == s.config.domain {
-				m.Answer = append(m.Answer, s.ns())
+			if strings.EqualFold(msg.Name, apex) {
+				m.Answer = append(m.Answer, s.ns(zone, apex))
 			}
 		case dns.TypeSOA: // dns info
-			if msg.Name == s.config.domain {
-				m.Answer = append(m.Answer, s.soa())
+			if strings.EqualFold(msg.Name, apex) {
+				m.Answer = append(m.Answer, s.soa(zone, apex))
 			}
-		case dns.TypeA: // ipv4
-			if strings.HasSuffix(msg.Name, s.config.domain) {
-				prefix := strings.TrimSpace(strings.TrimSuffix(msg.Name, "."+s.config.domain))
-				records, err := s.Lookup(prefix)
-				if err != nil {
-					log.Printf("[err] lookup %+v\n", err)
-				} else {
-					for _, record := range records {
-						ip := record.PublicIP
-						if s.config.private {
-							ip = record.PrivateIP
-						}
-						m.Answer = append(m.Answer, &dns.A{
-							Hdr: dns.RR_Header{
-								Name:   msg.Name,
-								Rrtype: dns.TypeA,
-								Class:  dns.ClassINET,
-								Ttl:    uint32(record.TTL() / time.Second),
-							},
-							A: ip,
-						})
+		case dns.TypePTR: // reverse
+			if !reverse {
+				break
+			}
+			ip := reverseIP(msg.Name)
+			if ip == nil {
+				break
+			}
+			records, err := s.store.ReverseLookup(ip)
+			if err == ErrStaleExpired {
+				expired = true
+			} else if err == ErrStaleDropped {
+				dropped = true
+			} else if err != nil {
+				log.Printf("[err] reverse lookup %+v\n", err)
+			} else {
+				for _, record := range records {
+					if record.Stale {
+						stale = true
 					}
+					m.Answer = append(m.Answer, &dns.PTR{
+						Hdr: dns.RR_Header{
+							Name:   msg.Name,
+							Rrtype: dns.TypePTR,
+							Class:  dns.ClassINET,
+							Ttl:    uint32(record.TTL() / time.Second),
+						},
+						Ptr: record.Canonical + "." + zone.domain,
+					})
+				}
+			}
+		case dns.TypeSRV: // services(ex: _http._tcp.web)
+			if reverse {
+				break
+			}
+			labels := strings.SplitN(strings.ToLower(trimZone(msg.Name, apex)), ".", 3)
+			if len(labels) != 3 || !isServiceName(labels[0]+"."+labels[1]) {
+				break
+			}
+			prefix, private, _ := selectors(labels[2], private, false)
+			records, err := s.lookup(prefix, zone)
+			if err == ErrStaleExpired {
+				expired = true
+			} else if err == ErrStaleDropped {
+				dropped = true
+			} else if err != nil {
+				log.Printf("[err] lookup %+v\n", err)
+			} else {
+				for _, record := range records {
+					rrs, extra := s.services(msg, labels[0]+"."+labels[1], record, zone.domain, private)
+					if len(rrs) == 0 {
+						continue
+					}
+					if record.Stale {
+						stale = true
+					}
+					m.Answer = append(m.Answer, rrs...)
+					m.Extra = append(m.Extra, extra...)
+				}
+			}
+		case dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeTXT: // ipv4, ipv6, hostname, metadata
+			if reverse {
+				break
+			}
+			// a cname label(ex: web.cname) or a cname config answers hostnames of providers instead of ips.
+			// private and public labels(ex: web.private) override a view and a zone for a query.
+			prefix, private, cname := selectors(trimZone(msg.Name, apex), private, zone.cname)
+			records, err := s.lookup(prefix, zone)
+			if err == ErrStaleExpired {
+				expired = true
+			} else if err == ErrStaleDropped {
+				dropped = true
+			} else if err != nil {
+				log.Printf("[err] lookup %+v\n", err)
+			} else if rr, record := s.cname(msg, records, private); cname && msg.Qtype != dns.TypeTXT && rr != nil {
+				if record.Stale {
+					stale = true
+				}
+				m.Answer = append(m.Answer, rr)
+			} else {
+				for _, record := range records {
+					// a record without data of a asked type(ex: no ipv6) is not answered(NODATA).
+					rr := s.answer(msg, record, private)
+					if rr == nil {
+						continue
+					}
+					if record.Stale {
+						stale = true
+					}
+					m.Answer = append(m.Answer, rr)
 				}
 			}
 		}
 	}
 
-	// if response is not exist.
+	// if response is not exist, a name without records of any type is NXDOMAIN, or NODATA(RFC 2308).
 	if len(m.Answer) == 0 {
-		m.Ns = append(m.Ns, s.soa())
+		if !expired && !dropped && len(m.Question) > 0 && !s.exists(m.Question[0].Name, zone, apex) {
+			m.Rcode = dns.RcodeNameError
+		}
+		m.Ns = append(m.Ns, s.negative(zone, apex))
+	}
+
+	// stale answers are noticed by extended dns errors (RFC 8914), if a client supports edns.
+	if expired {
+		m.Rcode = dns.RcodeServerFailure
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+		if expired {
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeOther, ExtraText: "stale records expired"})
+		} else if dropped && len(m.Answer) == 0 {
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeOther, ExtraText: "stale records dropped"})
+		} else if stale {
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer})
+		}
 	}
 
 	w.WriteMsg(m)
 }
 
-func (s *server) ns() *dns.NS {
+// answer returns a resource record of a record for a question, nil when a record has no data of a type.
+func (s *server) answer(q dns.Question, record *Record, private bool) dns.RR {
+	hdr := dns.RR_Header{
+		Name:   q.Name,
+		Rrtype: q.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(record.TTL() / time.Second),
+	}
+	switch q.Qtype {
+	case dns.TypeA:
+		if ip := s.address(record, q.Qtype, private); ip != nil {
+			return &dns.A{Hdr: hdr, A: ip}
+		}
+	case dns.TypeAAAA:
+		if ip := s.address(record, q.Qtype, private); ip != nil {
+			return &dns.AAAA{Hdr: hdr, AAAA: ip}
+		}
+	case dns.TypeTXT:
+		return &dns.TXT{Hdr: hdr, Txt: s.metadata(record)}
+	}
+	return nil
+}
+
+// cname returns a CNAME to a hostname of a first record having it, nil when no record has a hostname.
+// a name can have only one CNAME, so other records are not answered.
+func (s *server) cname(q dns.Question, records []*Record, private bool) (dns.RR, *Record) {
+	for _, record := range records {
+		hostname := record.PublicDNS
+		if private {
+			hostname = record.PrivateDNS
+		}
+		if hostname == "" {
+			continue
+		}
+		return &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: uint32(record.TTL() / time.Second)},
+			Target: dns.Fqdn(hostname),
+		}, record
+	}
+	return nil, nil
+}
+
+// services returns SRV records of a service of a record and addresses of a target for an additional section.
+// a target is a canonical name of a record, so a record without it is not answered.
+func (s *server) services(q dns.Question, name string, record *Record, domain string, private bool) ([]dns.RR, []dns.RR) {
+	if record.Canonical == "" {
+		return nil, nil
+	}
+	ttl := uint32(record.TTL() / time.Second)
+	target := record.Canonical + "." + domain
+
+	var rrs []dns.RR
+	for _, service := range record.Services {
+		if service.Name != name {
+			continue
+		}
+		rrs = append(rrs, &dns.SRV{
+			Hdr:      dns.RR_Header{Name: q.Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: ttl},
+			Priority: service.Priority,
+			Weight:   service.Weight,
+			Port:     service.Port,
+			Target:   target,
+		})
+	}
+	if len(rrs) == 0 {
+		return nil, nil
+	}
+
+	var extra []dns.RR
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		if rr := s.answer(dns.Question{Name: target, Qtype: qtype, Qclass: dns.ClassINET}, record, private); rr != nil {
+			extra = append(extra, rr)
+		}
+	}
+	return rrs, extra
+}
+
+// metadata returns key=value strings of a record(ex: vendor=AWS, id=i-0abc, tag:role=web).
+func (s *server) metadata(record *Record) []string {
+	txt := []string{"vendor=" + string(record.Vendor)}
+	location := "region"
+	if record.Vendor == GCP {
+		location = "zone"
+	}
+	for _, field := range []struct {
+		key   string
+		value string
+	}{
+		{key: location, value: record.ZoneOrRegion},
+		{key: "account", value: record.Account},
+		{key: "project", value: record.Project},
+		{key: "id", value: record.ID},
+		{key: "name", value: record.Name},
+		{key: "type", value: record.InstanceType},
+	} {
+		if field.value != "" {
+			txt = append(txt, field.key+"="+field.value)
+		}
+	}
+	if !record.LaunchTime.IsZero() {
+		txt = append(txt, "launch="+record.LaunchTime.UTC().Format(time.RFC3339))
+	}
+	if record.Stale {
+		txt = append(txt, "stale=true")
+	}
+	for _, key := range s.config.txtTags {
+		for tagKey, value := range record.Tags {
+			if strings.EqualFold(key, tagKey) {
+				txt = append(txt, "tag:"+tagKey+"="+value)
+			}
+		}
+	}
+
+	// a character-string is up to 255 bytes
+	for i, value := range txt {
+		if len(value) > 255 {
+			txt[i] = value[:255]
+		}
+	}
+	return txt
+}
+
+// address returns a public or private ip of a record for A or AAAA, nil when not exist.
+func (s *server) address(record *Record, qtype uint16, private bool) net.IP {
+	ip := record.PublicIP
+	if qtype == dns.TypeAAAA {
+		ip = record.PublicIPv6
+	}
+	if private {
+		ip = record.PrivateIP
+		if qtype == dns.TypeAAAA {
+			ip = record.PrivateIPv6
+		}
+	}
+
+	if qtype == dns.TypeA {
+		return ip.To4()
+	}
+	if ip == nil || ip.To4() != nil {
+		return nil
+	}
+	return ip.To16()
+}
+
+// private returns whether private ips are answered to a client.
+// a zone writing private decides it, otherwise a first view matched to a client and a listener decides it, or a zone decides it.
+func (s *server) private(w dns.ResponseWriter, zone *zoneConfig) bool {
+	if zone.fixed {
+		return zone.private
+	}
+	client, listener := addrIP(w.RemoteAddr()), addrIP(w.LocalAddr())
+	for _, view := range s.config.views {
+		if view.match(client, listener) {
+			return view.private
+		}
+	}
+	return zone.private
+}
+
+// match checks a client and a listener belong to a view.
+func (v *viewConfig) match(client, listener net.IP) bool {
+	if len(v.clients) > 0 {
+		matched := false
+		for _, network := range v.clients {
+			if client != nil && network.Contains(client) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(v.listeners) > 0 {
+		matched := false
+		for _, ip := range v.listeners {
+			if ip.Equal(listener) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// addrIP returns a ip of a udp or tcp address, nil when unknown.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// zone returns a zone which a name belongs to and its apex, nil when not exist.
+// reverse zones are answered by a primary zone, so a apex of them is a reverse zone.
+func (s *server) zone(name string) (*zoneConfig, string) {
+	name = strings.ToLower(name)
+	var found *zoneConfig
+	apex := ""
+	match := func(zone *zoneConfig, candidate string) {
+		lowered := strings.ToLower(candidate)
+		if (name == lowered || strings.HasSuffix(name, "."+lowered)) && len(candidate) > len(apex) {
+			found, apex = zone, candidate
+		}
+	}
+	for _, zone := range s.config.allZones() {
+		match(zone, zone.domain)
+	}
+	for _, reverse := range s.config.reverseZones {
+		match(&s.config.zoneConfig, reverse)
+	}
+	return found, apex
+}
+
+// trimZone returns labels of a name above a apex(ex: web.aws of web.aws.example.com.).
+func trimZone(name, apex string) string {
+	if len(name) <= len(apex) {
+		return ""
+	}
+	return strings.TrimSuffix(name[:len(name)-len(apex)], ".")
+}
+
+// exists reports whether a name in a zone has records of any type.
+// labels of usage(ex: aws, rr) and parents of indexed names(ex: role.tag) exist as empty non-terminals.
+func (s *server) exists(name string, zone *zoneConfig, apex string) bool {
+	name, apex = strings.ToLower(name), strings.ToLower(apex)
+	if name == apex || !strings.HasSuffix(name, "."+apex) {
+		return true
+	}
+
+	if apex != strings.ToLower(zone.domain) {
+		ip := reverseIP(name)
+		if ip == nil {
+			// a part of an address(ex: 0.10.in-addr.arpa) is a empty non-terminal
+			if prefix := strings.TrimSuffix(name, reverseV4Suffix); prefix != name {
+				return strings.Count(prefix, ".") < 3
+			}
+			if prefix := strings.TrimSuffix(name, reverseV6Suffix); prefix != name {
+				return strings.Count(prefix, ".") < 31
+			}
+			return false
+		}
+		records, err := s.store.ReverseLookup(ip)
+		return err != nil || len(records) > 0
+	}
+
+	// labels of a service(ex: _http._tcp.web) belong to a name of a instance
+	seps := strings.Split(trimZone(name, apex), ".")
+	for len(seps) > 1 && strings.HasPrefix(seps[0], "_") {
+		seps = seps[1:]
+	}
+	prefix, _, _ := selectors(strings.Join(seps, "."), false, false)
+	records, err := s.lookup(prefix, zone)
+	if err != nil || len(records) > 0 {
+		return true
+	}
+
+	seps = strings.Split(prefix, ".")
+	for len(seps) > 0 && isUsageLabel(seps[len(seps)-1]) {
+		seps = seps[:len(seps)-1]
+	}
+	return len(seps) == 0 || s.store.IsParent(strings.Join(seps, "."))
+}
+
+// selectors strips labels selecting answers at the end of a prefix, before or after suffixes of usage(ex: web.aws.private, web.private.aws, web.public.cname).
+// a private or a public label chooses ips, a cname label chooses hostnames of providers.
+func selectors(prefix string, private, cname bool) (string, bool, bool) {
+	seps := strings.Split(prefix, ".")
+	last := len(seps) - 1
+	for last >= 0 && isUsageLabel(strings.ToLower(seps[last])) {
+		last--
+	}
+	// a name of only usage labels(ex: private) is not a selector
+	if last < 0 {
+		return prefix, private, cname
+	}
+
+	labels := seps[:last+1]
+	var suffixes []string
+	for i := len(seps) - 1; i > last; i-- {
+		switch strings.ToLower(seps[i]) {
+		case dnsCname:
+			cname = true
+		case dnsPrivate:
+			private = true
+		case dnsPublic:
+			private = false
+		default:
+			suffixes = append([]string{seps[i]}, suffixes...)
+		}
+	}
+	return strings.Join(append(labels, suffixes...), "."), private, cname
+}
+
+// isUsageLabel checks a label is a suffix of usage(ex: web.aws, web.rr).
+func isUsageLabel(label string) bool {
+	switch label {
+	case "aws", "gcp", dnsRR, dnsCname, dnsPrivate, dnsPublic:
+		return true
+	}
+	return false
+}
+
+// negative returns a SOA for a authority section of negative answers, its ttl is a negative ttl(RFC 2308).
+func (s *server) negative(zone *zoneConfig, apex string) *dns.SOA {
+	soa := s.soa(zone, apex)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return soa
+}
+
+func (s *server) ns(zone *zoneConfig, apex string) *dns.NS {
 	return &dns.NS{
-		Hdr: dns.RR_Header{Name: s.config.domain, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: uint32(TTL / time.Second)},
-		Ns:  s.config.nameserver,
+		Hdr: dns.RR_Header{Name: apex, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: uint32(s.config.ttl / time.Second)},
+		Ns:  zone.nameserver,
 	}
 }
 
-func (s *server) soa() *dns.SOA {
+func (s *server) soa(zone *zoneConfig, apex string) *dns.SOA {
 	return &dns.SOA{
-		Hdr:     dns.RR_Header{Name: s.config.domain, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(TTL / time.Second)},
-		Ns:      s.config.nameserver,
-		Mbox:    s.config.rname,
-		Serial:  uint32(s.store.cacheUpdatedAt.Unix()), // cache updatedAt
-		Refresh: uint32((6 * time.Hour) / time.Second),
-		Retry:   uint32((30 * time.Minute) / time.Second),
-		Expire:  uint32((24 * time.Hour) / time.Second),
-		Minttl:  uint32((2 * time.Minute) / time.Second),
+		Hdr:     dns.RR_Header{Name: apex, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(s.config.ttl / time.Second)},
+		Ns:      zone.nameserver,
+		Mbox:    zone.rname,
+		Serial:  uint32(s.store.UpdatedAt().Unix()), // cache updatedAt
+		Refresh: uint32(zone.soaRefresh / time.Second),
+		Retry:   uint32(zone.soaRetry / time.Second),
+		Expire:  uint32(zone.soaExpire / time.Second),
+		Minttl:  uint32(zone.soaMinimum / time.Second),
 	}
 }
 
+// serves checks a record belongs to sources of a zone.
+func (z *zoneConfig) serves(record *Record) bool {
+	if len(z.sources) == 0 {
+		return true
+	}
+	for _, source := range z.sources {
+		seps := strings.SplitN(source, "/", 2)
+		if !strings.EqualFold(seps[0], string(record.Vendor)) {
+			continue
+		}
+		if len(seps) == 1 || strings.EqualFold(seps[1], record.Account) || strings.EqualFold(seps[1], record.Project) {
+			return true
+		}
+	}
+	return false
+}
+
 func NewServer(yamlPath string) (Server, error) {
 	if yamlPath == "" {
 		return nil, fmt.Errorf("[err] empty params")
@@ -236,7 +727,7 @@ func NewServer(yamlPath string) (Server, error) {
 	}
 
 	// generate dns table
-	store, err := NewStore(awsconfig, gcpconfig)
+	store, err := NewStore(commonConfig, NewProviders(awsconfig, gcpconfig)...)
 	if err != nil {
 		return nil, err
 	}
@@ -251,7 +742,12 @@ func NewServer(yamlPath string) (Server, error) {
 		publicIP: publicIP, store: store}
 
 	// register handler
-	dns.HandleFunc(s.config.domain, s.dnsRequest)
+	for _, zone := range s.config.allZones() {
+		dns.HandleFunc(zone.domain, s.dnsRequest)
+	}
+	for _, zone := range s.config.reverseZones {
+		dns.HandleFunc(zone, s.dnsRequest)
+	}
 	return Server(s), nil
 }
 
@@ -260,31 +756,33 @@ func checkConfig(config *CommonConfig) (*CommonConfig, error) {
 		return nil, fmt.Errorf("[err] empty checkConfig")
 	}
 
-	// check a machine state to be associated nameserver.
-	nsrecords, err := net.LookupNS(config.domain)
-	if err != nil {
-		log.Printf("%s %s not found NS Record %v\n", aurora.Red("[fail]"), aurora.Magenta(config.domain), err)
-	} else {
-		for _, ns := range nsrecords {
-			ips, err := net.LookupIP(ns.Host)
-			if err != nil {
-				log.Printf("%s %s not found NS Domain IP %v\n", aurora.Red("[fail]"), aurora.Magenta(ns.Host), err)
-			} else {
-				check := false
-				for _, ip := range ips {
-					if ip.String() == config.nameserver {
-						check = true
+	// check a machine state to be associated nameserver of each zones.
+	for _, zone := range config.allZones() {
+		nsrecords, err := net.LookupNS(zone.domain)
+		if err != nil {
+			log.Printf("%s %s not found NS Record %v\n", aurora.Red("[fail]"), aurora.Magenta(zone.domain), err)
+		} else {
+			for _, ns := range nsrecords {
+				ips, err := net.LookupIP(ns.Host)
+				if err != nil {
+					log.Printf("%s %s not found NS Domain IP %v\n", aurora.Red("[fail]"), aurora.Magenta(ns.Host), err)
+				} else {
+					check := false
+					for _, ip := range ips {
+						if ip.String() == zone.nameserver {
+							check = true
+						}
 					}
-				}
-				if check {
-					if config.nameserver == defaultNameServer {
-						log.Printf("%s matched %s \n", aurora.Green("[success-match-with-detect]"), aurora.Magenta(ns.Host))
-						config.nameserver = ns.Host
+					if check {
+						if zone.nameserver == defaultNameServer {
+							log.Printf("%s matched %s \n", aurora.Green("[success-match-with-detect]"), aurora.Magenta(ns.Host))
+							zone.nameserver = ns.Host
+						} else {
+							log.Printf("%s matched %s \n", aurora.Green("[success-match]"), aurora.Magenta(zone.nameserver))
+						}
 					} else {
-						log.Printf("%s matched %s \n", aurora.Green("[success-match]"), aurora.Magenta(config.nameserver))
+						log.Printf("%s not matched %s \n", aurora.Red("[fail]"), aurora.Magenta(zone.nameserver))
 					}
-				} else {
-					log.Printf("%s not matched %s \n", aurora.Red("[fail]"), aurora.Magenta(config.nameserver))
 				}
 			}
 		}
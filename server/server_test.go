@@ -1,12 +1,78 @@
 package server
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 )
 
+// fakeResponseWriter keeps a written message, addresses are localhost when empty.
+type fakeResponseWriter struct {
+	msg    *dns.Msg
+	local  string
+	remote string
+}
+
+func (w *fakeResponseWriter) LocalAddr() net.Addr {
+	if w.local != "" {
+		return &net.UDPAddr{IP: net.ParseIP(w.local), Port: 53}
+	}
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+}
+func (w *fakeResponseWriter) RemoteAddr() net.Addr {
+	if w.remote != "" {
+		return &net.TCPAddr{IP: net.ParseIP(w.remote), Port: 10053}
+	}
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10053}
+}
+func (w *fakeResponseWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+func (w *fakeResponseWriter) Write([]byte) (int, error) { return 0, nil }
+func (w *fakeResponseWriter) Close() error              { return nil }
+func (w *fakeResponseWriter) TsigStatus() error         { return nil }
+func (w *fakeResponseWriter) TsigTimersOnly(bool)       {}
+func (w *fakeResponseWriter) Hijack()                   {}
+
+// exchange answers a question using a handler of a server.
+func exchange(s *server, name string, qtype uint16, edns bool) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(name, qtype)
+	if edns {
+		r.SetEdns0(dns.DefaultMsgSize, false)
+	}
+	w := &fakeResponseWriter{}
+	s.dnsRequest(w, r)
+	return w.msg
+}
+
+// exchangeFrom answers a question from a client to a listener.
+func exchangeFrom(s *server, client, listener, name string, qtype uint16) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(name, qtype)
+	w := &fakeResponseWriter{remote: client, local: listener}
+	s.dnsRequest(w, r)
+	return w.msg
+}
+
+// extendedError returns a info code of extended dns error in a message.
+func extendedError(msg *dns.Msg) (uint16, bool) {
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if ede, ok := option.(*dns.EDNS0_EDE); ok {
+				return ede.InfoCode, true
+			}
+		}
+	}
+	return 0, false
+}
+
 func TestNewServer(t *testing.T) {
 	assert := assert.New(t)
 
@@ -36,6 +102,49 @@ func TestNewServer(t *testing.T) {
 func TestServer_Lookup(t *testing.T) {
 	assert := assert.New(t)
 
+	store, err := NewStore(nil, &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS, Account: "prod"}, Names: []string{"web", "web.prod", "frontend.role.tag", "3.version.tag"}},
+		{Record: &Record{Vendor: AWS, Account: "dev"}, Names: []string{"web", "web.dev"}},
+		{Record: &Record{Vendor: AWS}, Names: []string{"web"}},
+	}}, &fakeProvider{name: string(GCP), entries: []*Entry{
+		{Record: &Record{Vendor: GCP, Project: "project-a"}, Names: []string{"web", "web.project-a", "1234567890", "1234567890.project-a"}},
+	}})
+	assert.NoError(err)
+	fake := &server{store: store}
+
+	lookupTests := map[string]struct {
+		input   string
+		records int
+	}{
+		"name":          {input: "web", records: 4},
+		"vendor":        {input: "web.aws", records: 3},
+		"account":       {input: "web.prod.aws", records: 1},
+		"accountNumber": {input: "1.web.dev.aws", records: 1},
+		"accountOnly":   {input: "web.prod", records: 1},
+		"otherVendor":   {input: "web.prod.gcp", records: 0},
+		"project":       {input: "web.project-a.gcp", records: 1},
+		"number":        {input: "2.web", records: 1},
+		"overNumber":    {input: "5.web", records: 0},
+		"rr":            {input: "web.rr", records: 4},
+		"tag":           {input: "frontend.role.tag", records: 1},
+		"tagVendor":     {input: "frontend.role.tag.aws", records: 1},
+		"tagNumber":     {input: "1.frontend.role.tag", records: 1},
+		"tagOtherValue": {input: "backend.role.tag", records: 0},
+		"tagNumeric":    {input: "3.version.tag", records: 1},
+		"tagNumericAws": {input: "3.version.tag.aws", records: 1},
+		"tagNumericIdx": {input: "1.3.version.tag", records: 1},
+		"tagNumericGcp": {input: "3.version.tag.gcp", records: 0},
+		"projectId":     {input: "1234567890.project-a", records: 1},
+		"projectIdGcp":  {input: "1234567890.project-a.gcp", records: 1},
+		"projectIdAws":  {input: "1234567890.project-a.aws", records: 0},
+		"projectIdIdx":  {input: "1.1234567890.project-a.gcp", records: 1},
+	}
+	for _, t := range lookupTests {
+		records, err := fake.Lookup(t.input)
+		assert.NoError(err)
+		assert.Len(records, t.records)
+	}
+
 	yamlPath := os.Getenv("TEST_YAML_PATH")
 	if yamlPath != "" {
 		s, err := NewServer(yamlPath)
@@ -70,6 +179,311 @@ func TestServer_Lookup(t *testing.T) {
 	}
 }
 
+func TestServer_dnsRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	aws := &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS, Canonical: "web.i-1", PublicIP: net.ParseIP("1.1.1.1"), PrivateIP: net.ParseIP("10.0.0.1"),
+			PublicIPv6: net.ParseIP("2001:db8::1"), PrivateIPv6: net.ParseIP("fd20::1"),
+			PublicDNS: "ec2-1-1-1-1.compute.amazonaws.com", PrivateDNS: "ip-10-0-0-1.ec2.internal",
+			Services: []*Service{{Name: "_http._tcp", Port: 8080, Weight: 5, Priority: 1}}}, Names: []string{"web", "web.i-1"}},
+	}}
+	gcp := &fakeProvider{name: string(GCP), entries: []*Entry{
+		{Record: &Record{Vendor: GCP, Canonical: "db.100", PublicIP: net.ParseIP("2.2.2.2"), ZoneOrRegion: "fake-zone", Project: "fake-project",
+			ID: "100", Name: "db", InstanceType: "e2-medium", LaunchTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Tags: map[string]string{"Role": "database", "secret": "fake"}}, Names: []string{"db", "db.100"}},
+	}}
+	config := &CommonConfig{zoneConfig: zoneConfig{domain: "example.com.", nameserver: "ns.example.com.", soaMinimum: time.Minute},
+		ttl: TTL, reverseZones: []string{"10.in-addr.arpa.", "2.2.2.in-addr.arpa."}, txtTags: []string{"role"},
+		staleMaxAge: time.Hour, staleAction: staleActionServfail}
+	store, err := NewStore(config, aws, gcp)
+	assert.NoError(err)
+	fake := &server{config: config, store: store}
+
+	msg := exchange(fake, "web.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	assert.Len(msg.Answer, 1)
+	_, ok := extendedError(msg)
+	assert.False(ok)
+
+	// ipv6
+	msg = exchange(fake, "web.example.com.", dns.TypeAAAA, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("2001:db8::1", msg.Answer[0].(*dns.AAAA).AAAA.String())
+
+	// a instance without an address of a asked family is NODATA
+	msg = exchange(fake, "db.example.com.", dns.TypeAAAA, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	assert.Len(msg.Answer, 0)
+	assert.Len(msg.Ns, 1)
+	assert.Equal(dns.TypeSOA, msg.Ns[0].Header().Rrtype)
+	config.private = true
+	msg = exchange(fake, "db.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 0)
+	msg = exchange(fake, "web.example.com.", dns.TypeAAAA, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("fd20::1", msg.Answer[0].(*dns.AAAA).AAAA.String())
+	config.private = false
+
+	// a name without records is NXDOMAIN with a negative ttl, empty non-terminals are NODATA
+	msg = exchange(fake, "unknown.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	assert.Len(msg.Ns, 1)
+	assert.Equal(uint32(60), msg.Ns[0].Header().Ttl)
+	msg = exchange(fake, "2.web.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	msg = exchange(fake, "web.gcp.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	for _, name := range []string{"example.com.", "aws.example.com.", "i-1.example.com.", "web.rr.example.com.", "_grpc._tcp.web.example.com.", "web.cname.example.com."} {
+		msg = exchange(fake, name, dns.TypeMX, true)
+		assert.Equal(dns.RcodeSuccess, msg.Rcode, name)
+		assert.Len(msg.Answer, 0)
+		assert.Equal(uint32(60), msg.Ns[0].Header().Ttl)
+	}
+	msg = exchange(fake, "9.0.0.10.in-addr.arpa.", dns.TypePTR, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	msg = exchange(fake, "0.0.10.in-addr.arpa.", dns.TypePTR, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	msg = exchange(fake, "1.0.0.10.in-addr.arpa.", dns.TypeA, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+
+	// reverse
+	msg = exchange(fake, "1.0.0.10.in-addr.arpa.", dns.TypePTR, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("web.i-1.example.com.", msg.Answer[0].(*dns.PTR).Ptr)
+	msg = exchange(fake, "2.2.2.2.in-addr.arpa.", dns.TypePTR, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("db.100.example.com.", msg.Answer[0].(*dns.PTR).Ptr)
+	msg = exchange(fake, "9.0.0.10.in-addr.arpa.", dns.TypePTR, true)
+	assert.Len(msg.Answer, 0)
+	assert.Equal("10.in-addr.arpa.", msg.Ns[0].Header().Name)
+	msg = exchange(fake, "10.in-addr.arpa.", dns.TypeSOA, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("10.in-addr.arpa.", msg.Answer[0].Header().Name)
+	msg = exchange(fake, "web.i-1.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 1)
+
+	// metadata
+	msg = exchange(fake, "db.example.com.", dns.TypeTXT, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal([]string{"vendor=GCP", "zone=fake-zone", "project=fake-project", "id=100", "name=db", "type=e2-medium",
+		"launch=2020-01-02T03:04:05Z", "tag:Role=database"}, msg.Answer[0].(*dns.TXT).Txt)
+	msg = exchange(fake, "web.example.com.", dns.TypeTXT, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal([]string{"vendor=AWS"}, msg.Answer[0].(*dns.TXT).Txt)
+
+	// services
+	msg = exchange(fake, "_http._tcp.web.example.com.", dns.TypeSRV, true)
+	assert.Len(msg.Answer, 1)
+	srv := msg.Answer[0].(*dns.SRV)
+	assert.Equal("web.i-1.example.com.", srv.Target)
+	assert.Equal([]uint16{8080, 5, 1}, []uint16{srv.Port, srv.Weight, srv.Priority})
+	assert.Len(msg.Extra, 3) // a, aaaa and opt
+	assert.Equal("1.1.1.1", msg.Extra[0].(*dns.A).A.String())
+	msg = exchange(fake, "_HTTP._tcp.1.web.aws.example.com.", dns.TypeSRV, true)
+	assert.Len(msg.Answer, 1)
+	msg = exchange(fake, "_grpc._tcp.web.example.com.", dns.TypeSRV, true)
+	assert.Len(msg.Answer, 0)
+	msg = exchange(fake, "web.example.com.", dns.TypeSRV, true)
+	assert.Len(msg.Answer, 0)
+
+	// hostnames
+	msg = exchange(fake, "web.cname.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("ec2-1-1-1-1.compute.amazonaws.com.", msg.Answer[0].(*dns.CNAME).Target)
+	msg = exchange(fake, "web.aws.cname.example.com.", dns.TypeCNAME, true)
+	assert.Len(msg.Answer, 1)
+	msg = exchange(fake, "web.example.com.", dns.TypeCNAME, true)
+	assert.Len(msg.Answer, 0)
+	msg = exchange(fake, "db.cname.example.com.", dns.TypeA, true) // no hostname answers ips
+	assert.Len(msg.Answer, 1)
+	assert.Equal("2.2.2.2", msg.Answer[0].(*dns.A).A.String())
+	config.cname, config.private = true, true
+	msg = exchange(fake, "web.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("ip-10-0-0-1.ec2.internal.", msg.Answer[0].(*dns.CNAME).Target)
+	msg = exchange(fake, "web.example.com.", dns.TypeTXT, true)
+	assert.Equal(dns.TypeTXT, msg.Answer[0].Header().Rrtype)
+	config.cname, config.private = false, false
+
+	// stale answers have a extended dns error
+	gcp.err = fmt.Errorf("[err] fake")
+	assert.NoError(store.renewal())
+	msg = exchange(fake, "db.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	assert.Len(msg.Answer, 1)
+	code, ok := extendedError(msg)
+	assert.True(ok)
+	assert.Equal(dns.ExtendedErrorCodeStaleAnswer, code)
+
+	// a client without edns doesn't get options
+	msg = exchange(fake, "db.example.com.", dns.TypeA, false)
+	assert.Len(msg.Answer, 1)
+	assert.Nil(msg.IsEdns0())
+
+	// SERVFAIL after a max age
+	for _, state := range store.states {
+		for _, entry := range state.entries {
+			entry.Record.UpdatedAt = entry.Record.UpdatedAt.Add(-2 * time.Hour)
+		}
+	}
+	msg = exchange(fake, "db.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeServerFailure, msg.Rcode)
+	assert.Len(msg.Answer, 0)
+	code, ok = extendedError(msg)
+	assert.True(ok)
+	assert.Equal(dns.ExtendedErrorCodeOther, code)
+
+	// NODATA after a max age when dropped, a dropped name is not NXDOMAIN
+	store.staleAction = staleActionDrop
+	msg = exchange(fake, "db.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	assert.Len(msg.Answer, 0)
+	assert.Len(msg.Ns, 1)
+	code, ok = extendedError(msg)
+	assert.True(ok)
+	assert.Equal(dns.ExtendedErrorCodeOther, code)
+	msg = exchange(fake, "db.100.example.com.", dns.TypeTXT, true)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	assert.Len(msg.Answer, 0)
+	msg = exchange(fake, "cache.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+}
+
+func TestServer_zones(t *testing.T) {
+	assert := assert.New(t)
+
+	aws := &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS, Account: "prod", Canonical: "web.i-1", PublicIP: net.ParseIP("1.1.1.1"), PrivateIP: net.ParseIP("10.0.0.1")},
+			Names: []string{"web", "web.prod"}},
+		{Record: &Record{Vendor: AWS, Account: "dev", Canonical: "web.i-2", PublicIP: net.ParseIP("1.1.1.2"), PrivateIP: net.ParseIP("10.0.0.2")},
+			Names: []string{"web", "web.dev"}},
+	}}
+	gcp := &fakeProvider{name: string(GCP), entries: []*Entry{
+		{Record: &Record{Vendor: GCP, Project: "fake-project", Canonical: "web.100", PublicIP: net.ParseIP("2.2.2.2"), PrivateIP: net.ParseIP("10.1.0.1")},
+			Names: []string{"web"}},
+	}}
+	config := &CommonConfig{zoneConfig: zoneConfig{domain: "example.com.", nameserver: "ns.example.com.", soaMinimum: time.Minute},
+		zones: []*zoneConfig{
+			{domain: "int.example.com.", nameserver: "ns.int.example.com.", private: true, soaMinimum: 30 * time.Second},
+			{domain: "pub.example.com.", nameserver: "ns.pub.example.com.", sources: []string{"aws/Prod"}},
+		}, ttl: TTL}
+	store, err := NewStore(config, aws, gcp)
+	assert.NoError(err)
+	fake := &server{config: config, store: store}
+
+	// a primary zone answers public ips of every sources
+	msg := exchange(fake, "web.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 3)
+
+	// a private zone answers private ips with its own soa
+	msg = exchange(fake, "web.INT.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 3)
+	for _, rr := range msg.Answer {
+		assert.Equal(byte(10), rr.(*dns.A).A.To4()[0])
+	}
+	msg = exchange(fake, "int.example.com.", dns.TypeSOA, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("int.example.com.", msg.Answer[0].Header().Name)
+	assert.Equal("ns.int.example.com.", msg.Answer[0].(*dns.SOA).Ns)
+	msg = exchange(fake, "int.example.com.", dns.TypeNS, true)
+	assert.Equal("ns.int.example.com.", msg.Answer[0].(*dns.NS).Ns)
+	msg = exchange(fake, "unknown.int.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	assert.Equal(uint32(30), msg.Ns[0].Header().Ttl)
+
+	// a zone having sources answers only them
+	msg = exchange(fake, "web.pub.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 1)
+	assert.Equal("1.1.1.1", msg.Answer[0].(*dns.A).A.String())
+	msg = exchange(fake, "1.web.pub.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 1)
+	msg = exchange(fake, "2.web.pub.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	msg = exchange(fake, "web.dev.pub.example.com.", dns.TypeA, true)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+	msg = exchange(fake, "web.gcp.pub.example.com.", dns.TypeA, true)
+	assert.Len(msg.Answer, 0)
+
+	// a name out of zones is not answered
+	msg = exchange(fake, "web.example.org.", dns.TypeA, true)
+	assert.Len(msg.Answer, 0)
+}
+
+func TestServer_views(t *testing.T) {
+	assert := assert.New(t)
+
+	aws := &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS, PublicIP: net.ParseIP("1.1.1.1"), PrivateIP: net.ParseIP("10.0.0.1")}, Names: []string{"web"}},
+	}}
+	_, vpc, _ := net.ParseCIDR("10.0.0.0/8")
+	_, office, _ := net.ParseCIDR("203.0.113.0/24")
+	config := &CommonConfig{zoneConfig: zoneConfig{domain: "example.com.", nameserver: "ns.example.com."},
+		zones: []*zoneConfig{
+			{domain: "int.example.com.", nameserver: "ns.example.com.", private: true, fixed: true},
+			{domain: "pub.example.com.", nameserver: "ns.example.com."},
+		},
+		views: []*viewConfig{
+			{name: "office", clients: []*net.IPNet{office}},
+			{name: "vpc", clients: []*net.IPNet{vpc}, private: true},
+			{name: "internal-listener", listeners: []net.IP{net.ParseIP("10.0.0.53")}, private: true},
+		}, listens: []string{"10.0.0.53", "1.2.3.4"}, ttl: TTL}
+	store, err := NewStore(config, aws)
+	assert.NoError(err)
+	fake := &server{config: config, store: store}
+
+	tests := map[string]struct {
+		client   string
+		listener string
+		name     string
+		ip       string
+	}{
+		"vpc":               {client: "10.1.2.3", listener: "1.2.3.4", name: "web.example.com.", ip: "10.0.0.1"},
+		"office":            {client: "203.0.113.7", listener: "1.2.3.4", name: "web.example.com.", ip: "1.1.1.1"},
+		"officeListener":    {client: "203.0.113.7", listener: "10.0.0.53", name: "web.example.com.", ip: "1.1.1.1"},
+		"listener":          {client: "198.51.100.1", listener: "10.0.0.53", name: "web.example.com.", ip: "10.0.0.1"},
+		"noView":            {client: "198.51.100.1", listener: "1.2.3.4", name: "web.example.com.", ip: "1.1.1.1"},
+		"wildcardListener":  {client: "198.51.100.1", listener: "0.0.0.0", name: "web.example.com.", ip: "1.1.1.1"},
+		"noViewZone":        {client: "198.51.100.1", listener: "1.2.3.4", name: "web.int.example.com.", ip: "10.0.0.1"},
+		"zoneOverrideView":  {client: "203.0.113.7", listener: "1.2.3.4", name: "web.int.example.com.", ip: "10.0.0.1"},
+		"inheritedZone":     {client: "10.1.2.3", listener: "1.2.3.4", name: "web.pub.example.com.", ip: "10.0.0.1"},
+		"privateLabel":      {client: "203.0.113.7", listener: "1.2.3.4", name: "web.private.example.com.", ip: "10.0.0.1"},
+		"publicLabel":       {client: "10.1.2.3", listener: "1.2.3.4", name: "web.public.example.com.", ip: "1.1.1.1"},
+		"publicLabelZone":   {client: "198.51.100.1", listener: "1.2.3.4", name: "web.PUBLIC.int.example.com.", ip: "1.1.1.1"},
+		"labelVendor":       {client: "10.1.2.3", listener: "1.2.3.4", name: "1.web.aws.public.example.com.", ip: "1.1.1.1"},
+		"labelBeforeVendor": {client: "203.0.113.7", listener: "1.2.3.4", name: "web.private.aws.example.com.", ip: "10.0.0.1"},
+		"labelBeforeRR":     {client: "10.1.2.3", listener: "1.2.3.4", name: "web.public.rr.example.com.", ip: "1.1.1.1"},
+	}
+	for name, t := range tests {
+		msg := exchangeFrom(fake, t.client, t.listener, t.name, dns.TypeA)
+		if assert.Len(msg.Answer, 1, name) {
+			assert.Equal(t.ip, msg.Answer[0].(*dns.A).A.String(), name)
+		}
+	}
+
+	// selector labels are empty non-terminals, not NXDOMAIN
+	msg := exchangeFrom(fake, "10.1.2.3", "1.2.3.4", "public.example.com.", dns.TypeA)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	msg = exchangeFrom(fake, "10.1.2.3", "1.2.3.4", "web.private.example.com.", dns.TypeMX)
+	assert.Equal(dns.RcodeSuccess, msg.Rcode)
+	msg = exchangeFrom(fake, "10.1.2.3", "1.2.3.4", "db.private.example.com.", dns.TypeA)
+	assert.Equal(dns.RcodeNameError, msg.Rcode)
+
+	prefix, private, cname := selectors("web.aws.Private.cname", false, false)
+	assert.Equal("web.aws", prefix)
+	assert.True(private)
+	assert.True(cname)
+	prefix, private, cname = selectors("web.private.cname.aws", false, false)
+	assert.Equal("web.aws", prefix)
+	assert.True(private)
+	assert.True(cname)
+	prefix, private, cname = selectors("private", false, false)
+	assert.Equal("private", prefix)
+	assert.False(private)
+	assert.False(cname)
+}
+
 func TestServer_Start(t *testing.T) {
 	assert := assert.New(t)
 	yamlPath := os.Getenv("TEST_YAML_PATH")
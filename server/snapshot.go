@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot is a last-known state of every sources written to disk.
+// it is served as stale at boot when cloud apis are unavailable.
+type snapshot struct {
+	UpdatedAt time.Time                  `json:"updated_at"`
+	Sources   map[string]*snapshotSource `json:"sources"` // map[provider/source]
+}
+
+type snapshotSource struct {
+	Provider  string    `json:"provider"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Entries   []*Entry  `json:"entries"`
+}
+
+// writeSnapshot writes states to a file atomically, readers never see a partial file.
+func writeSnapshot(file string, states map[string]*sourceState) error {
+	snap := &snapshot{UpdatedAt: time.Now(), Sources: make(map[string]*snapshotSource)}
+	for name, state := range states {
+		snap.Sources[name] = &snapshotSource{Provider: state.provider, UpdatedAt: state.updatedAt, Entries: state.entries}
+	}
+	bys, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bys); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// readSnapshot reads a snapshot file.
+func readSnapshot(file string) (*snapshot, error) {
+	bys, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{}
+	if err := json.Unmarshal(bys, snap); err != nil {
+		return nil, err
+	}
+	if len(snap.Sources) == 0 {
+		return nil, fmt.Errorf("[err] readSnapshot empty %s", file)
+	}
+	return snap, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+
+	states := map[string]*sourceState{
+		"AWS/us-east-1": {provider: "AWS", entries: []*Entry{
+			{Record: &Record{Vendor: AWS, PublicIP: net.ParseIP("1.1.1.1")}, Names: []string{"i-1", "web"}},
+		}},
+	}
+	assert.NoError(writeSnapshot(file, states))
+
+	// a temporary file is not left
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 1)
+
+	snap, err := readSnapshot(file)
+	assert.NoError(err)
+	assert.Len(snap.Sources, 1)
+	assert.Equal("AWS", snap.Sources["AWS/us-east-1"].Provider)
+	assert.Equal([]string{"i-1", "web"}, snap.Sources["AWS/us-east-1"].Entries[0].Names)
+	assert.Equal("1.1.1.1", snap.Sources["AWS/us-east-1"].Entries[0].Record.PublicIP.String())
+
+	_, err = readSnapshot(filepath.Join(dir, "unknown.json"))
+	assert.Error(err)
+	assert.NoError(ioutil.WriteFile(file, []byte("{}"), 0644))
+	_, err = readSnapshot(file)
+	assert.Error(err)
+}
+
+func TestStore_restore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	config := &CommonConfig{snapshot: filepath.Join(dir, "snapshot.json")}
+
+	aws := &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS, PublicIP: net.ParseIP("1.1.1.1")}, Names: []string{"i-1", "web"}},
+	}}
+
+	// a good renewal writes a snapshot
+	_, err = NewStore(config, aws)
+	assert.NoError(err)
+	_, err = os.Stat(config.snapshot)
+	assert.NoError(err)
+
+	// a snapshot is served as stale when cloud apis are down at boot
+	aws.sourcesErr = fmt.Errorf("[err] fake")
+	store, err := NewStore(config, aws)
+	assert.NoError(err)
+	records, err := store.Lookup("web")
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.True(records[0].Stale)
+	assert.Equal("1.1.1.1", records[0].PublicIP.String())
+	assert.Equal(defaultMinTTL, records[0].TTL())
+	statuses := store.Status()
+	assert.Len(statuses, 1)
+	assert.True(statuses[0].Stale)
+	assert.Error(statuses[0].Err)
+
+	// a failed renewal doesn't overwrite a snapshot, a next success replaces stale records
+	assert.Error(store.renewal())
+	aws.sourcesErr = nil
+	aws.entries = append(aws.entries, &Entry{Record: &Record{Vendor: AWS}, Names: []string{"i-2", "web"}})
+	assert.NoError(store.renewal())
+	records, err = store.Lookup("web")
+	assert.NoError(err)
+	assert.Len(records, 2)
+	for _, record := range records {
+		assert.False(record.Stale)
+	}
+
+	// a snapshot is served for failed sources when other sources are up at boot
+	config.snapshot = filepath.Join(dir, "partial.json")
+	gcp := &fakeProvider{name: string(GCP), entries: []*Entry{
+		{Record: &Record{Vendor: GCP, PublicIP: net.ParseIP("2.2.2.2")}, Names: []string{"100", "db"}},
+	}}
+	_, err = NewStore(config, aws, gcp)
+	assert.NoError(err)
+	for _, fail := range []func(){
+		func() { gcp.sourcesErr = fmt.Errorf("[err] fake") },               // a provider fails to list sources
+		func() { gcp.sourcesErr, gcp.err = nil, fmt.Errorf("[err] fake") }, // a source fails to fetch
+	} {
+		fail()
+		store, err = NewStore(config, aws, gcp)
+		assert.NoError(err)
+		records, err = store.Lookup("db")
+		assert.NoError(err)
+		if assert.Len(records, 1) {
+			assert.True(records[0].Stale)
+		}
+		records, err = store.Lookup("web")
+		assert.NoError(err)
+		assert.Len(records, 2)
+		assert.False(records[0].Stale)
+
+		// a snapshot rewritten by live sources keeps last-known records of failed sources
+		snap, err := readSnapshot(config.snapshot)
+		assert.NoError(err)
+		assert.Len(snap.Sources, 2)
+		for _, source := range snap.Sources {
+			assert.Len(source.Entries, map[string]int{string(AWS): 2, string(GCP): 1}[source.Provider])
+		}
+	}
+
+	// a full outage after a partial one still serves every providers
+	aws.sourcesErr = fmt.Errorf("[err] fake")
+	store, err = NewStore(config, aws, gcp)
+	assert.NoError(err)
+	for name, n := range map[string]int{"web": 2, "db": 1} {
+		records, err = store.Lookup(name)
+		assert.NoError(err)
+		assert.Len(records, n)
+	}
+	aws.sourcesErr, gcp.err = nil, nil
+
+	// without a snapshot, a first renewal must be success
+	aws.sourcesErr = fmt.Errorf("[err] fake")
+	_, err = NewStore(&CommonConfig{snapshot: filepath.Join(dir, "unknown.json")}, aws)
+	assert.Error(err)
+	_, err = NewStore(nil, aws)
+	assert.Error(err)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	srvTag         = "dns-srv"          // ex) _http._tcp:8080 or http-tcp-8080, several services are separated by a comma
+	srvWeightTag   = "dns-srv-weight"   // weight of every services of a instance
+	srvPriorityTag = "dns-srv-priority" // priority of every services of a instance
+
+	defaultSrvWeight   = 10
+	defaultSrvPriority = 10
+)
+
+// Service is a service of a instance answered in SRV(ex: _http._tcp.web).
+type Service struct {
+	Name     string // _service._proto
+	Port     uint16
+	Weight   uint16
+	Priority uint16
+}
+
+// parseServices returns services of tags, invalid services are skipped and a tag key is case-insensitive.
+func parseServices(tags map[string]string) []*Service {
+	var raw, weight, priority string
+	for key, value := range tags {
+		switch strings.ToLower(key) {
+		case srvTag:
+			raw = value
+		case srvWeightTag:
+			weight = value
+		case srvPriorityTag:
+			priority = value
+		}
+	}
+	if raw == "" {
+		return nil
+	}
+
+	var services []*Service
+	for _, raw := range strings.Split(raw, ",") {
+		name, port, ok := parseService(strings.TrimSpace(raw))
+		if !ok {
+			continue
+		}
+		services = append(services, &Service{
+			Name:     name,
+			Port:     port,
+			Weight:   parseUint16(weight, defaultSrvWeight),
+			Priority: parseUint16(priority, defaultSrvPriority),
+		})
+	}
+	return services
+}
+
+// parseService parses _service._proto:port, or service-proto-port for gcp labels which can't have '_', '.' and ':'.
+func parseService(raw string) (string, uint16, bool) {
+	var name, port string
+	if seps := strings.Split(raw, ":"); len(seps) == 2 {
+		name, port = strings.ToLower(seps[0]), seps[1]
+	} else if seps := strings.Split(raw, "-"); len(seps) >= 3 {
+		name = "_" + strings.Join(seps[:len(seps)-2], "-") + "._" + seps[len(seps)-2]
+		port = seps[len(seps)-1]
+	}
+	if !isServiceName(name) {
+		return "", 0, false
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || n == 0 {
+		return "", 0, false
+	}
+	return strings.ToLower(name), uint16(n), true
+}
+
+// isServiceName checks a name is _service._proto.
+func isServiceName(name string) bool {
+	labels := strings.Split(name, ".")
+	if len(labels) != 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) < 2 || !strings.HasPrefix(label, "_") {
+			return false
+		}
+	}
+	return true
+}
+
+func parseUint16(v string, fallback uint16) uint16 {
+	n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 16)
+	if err != nil {
+		return fallback
+	}
+	return uint16(n)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServices(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]struct {
+		tags     map[string]string
+		services []*Service
+	}{
+		"empty": {tags: map[string]string{"Name": "web"}},
+		"one": {tags: map[string]string{"dns-srv": "_http._tcp:8080"},
+			services: []*Service{{Name: "_http._tcp", Port: 8080, Weight: defaultSrvWeight, Priority: defaultSrvPriority}}},
+		"several": {tags: map[string]string{"DNS-SRV": "_HTTP._tcp:8080, _grpc._tcp:9090", "dns-srv-weight": "5", "Dns-Srv-Priority": "1"},
+			services: []*Service{{Name: "_http._tcp", Port: 8080, Weight: 5, Priority: 1}, {Name: "_grpc._tcp", Port: 9090, Weight: 5, Priority: 1}}},
+		"label": {tags: map[string]string{"dns-srv": "my-app-udp-53"},
+			services: []*Service{{Name: "_my-app._udp", Port: 53, Weight: defaultSrvWeight, Priority: defaultSrvPriority}}},
+		"invalid": {tags: map[string]string{"dns-srv": "http:8080,_http:8080,_http._tcp:0,_http._tcp:70000,_http._tcp,_http._tcp:80", "dns-srv-weight": "heavy"},
+			services: []*Service{{Name: "_http._tcp", Port: 80, Weight: defaultSrvWeight, Priority: defaultSrvPriority}}},
+	}
+	for _, t := range tests {
+		assert.Equal(t.services, parseServices(t.tags))
+	}
+}
@@ -1,20 +1,17 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"hash/crc32"
 	"log"
 	"net"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/logrusorgru/aurora"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
 type CloudVendor string
@@ -26,29 +23,108 @@ const (
 )
 
 const (
-	CacheName             = "CLOUD-NAME-SERVER"
-	UNKNOWN   CloudVendor = "UNKNOWN"
-	AWS       CloudVendor = "AWS"
-	GCP       CloudVendor = "GCP"
+	CacheName                    = "CLOUD-NAME-SERVER"
+	ReverseCacheName             = "CLOUD-NAME-SERVER-REVERSE"
+	ParentCacheName              = "CLOUD-NAME-SERVER-PARENT"
+	UNKNOWN          CloudVendor = "UNKNOWN"
+	AWS              CloudVendor = "AWS"
+	GCP              CloudVendor = "GCP"
 )
 
+// ErrStaleExpired is returned by a lookup when every records are stale longer than a max age.
+var ErrStaleExpired = fmt.Errorf("[err] records are stale longer than a max age")
+
+// ErrStaleDropped is returned by a lookup when every records are dropped for being stale longer than a max age.
+var ErrStaleDropped = fmt.Errorf("[err] records are dropped for being stale longer than a max age")
+
 type Store struct {
-	awsconf        *AwsConfig
-	gcpconf        *GcpConfig
+	providers      []InstanceProvider
 	cache          *sync.Map
 	cacheUpdatedAt time.Time
+	mu             sync.RWMutex
+	states         map[string]*sourceState // map[provider/source]state
+	failed         map[string]error        // providers failed to list sources, map[provider]error
+	fetching       chan struct{}           // sources being fetched, bounded by a concurrency
+	timeout        time.Duration           // deadline of fetching a source
+	refresh        time.Duration           // common refresh interval
+	ttl            time.Duration           // common ttl
+	minTTL         time.Duration
+	snapshot       string // path of a snapshot file, empty means disabled
+	staleMaxAge    time.Duration
+	staleAction    string
+	collisions     map[string]bool // names logged as collisions
+}
+
+// fetchJob is a source fetched in a renewal.
+type fetchJob struct {
+	provider string
+	name     string
+	source   Source
+	entries  []*Entry
+	err      error
+}
+
+// sourceState keeps last-known entries of a source.
+type sourceState struct {
+	provider  string
+	entries   []*Entry
+	updatedAt time.Time // last success
+	err       error     // last error, entries are stale when not nil
+}
+
+// SourceStatus is a refresh state of a source.
+type SourceStatus struct {
+	Name      string
+	Records   int
+	UpdatedAt time.Time
+	Stale     bool
+	Err       error
 }
 
 type Record struct {
 	Vendor       CloudVendor
 	ZoneOrRegion string
+	ID           string // instance id
+	Name         string // Name tag of aws or instance name of gcp
+	Canonical    string // unique name of a instance(ex: web.i-0abc)
+	InstanceType string
+	LaunchTime   time.Time
+	Account      string // aws account alias
+	Project      string // gcp project id
 	PublicIP     net.IP
 	PrivateIP    net.IP
+	PublicIPv6   net.IP
+	PrivateIPv6  net.IP
+	PublicDNS    string            // hostname given by a provider resolving to a public ip
+	PrivateDNS   string            // hostname given by a provider resolving to a private ip
+	Tags         map[string]string // aws tags or gcp labels
+	Services     []*Service        // services answered in SRV, from tags
 	ExpiredAt    time.Time
+	UpdatedAt    time.Time // last refresh of a source
+	Stale        bool      // a source failed to refresh, the record is last-known
+	minTTL       time.Duration
 }
 
 func (s *Store) Lookup(key string) ([]*Record, error) {
-	m, ok := s.cache.Load(CacheName)
+	return s.lookup(CacheName, key)
+}
+
+// ReverseLookup returns records having an ip.
+func (s *Store) ReverseLookup(ip net.IP) ([]*Record, error) {
+	return s.lookup(ReverseCacheName, ip.String())
+}
+
+// IsParent reports whether names below a name are indexed(ex: role.tag of web.role.tag).
+func (s *Store) IsParent(name string) bool {
+	m, ok := s.cache.Load(ParentCacheName)
+	if !ok {
+		return false
+	}
+	return m.(map[string]bool)[strings.ToLower(name)]
+}
+
+func (s *Store) lookup(cacheName, key string) ([]*Record, error) {
+	m, ok := s.cache.Load(cacheName)
 	if !ok {
 		return nil, fmt.Errorf("[err] unknown error<not found store table>")
 	}
@@ -56,93 +132,331 @@ func (s *Store) Lookup(key string) ([]*Record, error) {
 	if !ok {
 		return []*Record{}, nil
 	}
-	return records, nil
+
+	// records stale longer than a max age are not answered (RFC 8767)
+	now := time.Now()
+	servable := make([]*Record, 0, len(records))
+	for _, record := range records {
+		if record.Stale && now.Sub(record.UpdatedAt) > s.staleMaxAge {
+			continue
+		}
+		servable = append(servable, record)
+	}
+	if len(servable) == 0 && len(records) > 0 {
+		if s.staleAction == staleActionServfail {
+			return nil, ErrStaleExpired
+		}
+		// a dropped name still exists, so it is NODATA rather than NXDOMAIN
+		return nil, ErrStaleDropped
+	}
+	return servable, nil
 }
 
 func (s *Store) renewal() error {
+	return s.renew(s.providers)
+}
+
+// schedule returns refresh interval and ttl of a provider.
+func (s *Store) schedule(provider InstanceProvider) (time.Duration, time.Duration) {
+	refresh, ttl := s.refresh, s.ttl
+	if scheduler, ok := provider.(Scheduler); ok {
+		r, t := scheduler.Schedule()
+		if r > 0 {
+			refresh = r
+		}
+		if t > 0 {
+			ttl = t
+		}
+	}
+	return refresh, ttl
+}
+
+// renew refreshes sources of providers, sources of other providers are kept.
+func (s *Store) renew(providers []InstanceProvider) error {
 	now := time.Now()
 
-	table := make(LookupTable)
-	count := 0
-	// aws renewal
-	if s.awsconf != nil {
-		// get running instances
-		input := &ec2.DescribeInstancesInput{
-			Filters: []*ec2.Filter{
-				{Name: aws.String("instance-state-name"), Values: []*string{aws.String("running")}},
-			},
-		}
-
-		for region, client := range s.awsconf.clients {
-			output, err := client.DescribeInstances(input)
-			if err != nil {
-				return err
-			} else {
-				for _, rv := range output.Reservations {
-					for _, inst := range rv.Instances {
-						record := &Record{Vendor: AWS, ExpiredAt: now.Add(TTL), ZoneOrRegion: region}
-
-						// insert public ip
-						if inst.PublicIpAddress != nil {
-							if value := net.ParseIP(*inst.PublicIpAddress); value != nil {
-								record.PublicIP = value
-							}
-						}
-
-						// insert private ip
-						if inst.PrivateIpAddress != nil {
-							if value := net.ParseIP(*inst.PrivateIpAddress); value != nil {
-								record.PrivateIP = value
-							}
-						}
-
-						count += 1
-						// register instance-id
-						table[strings.ToLower(*inst.InstanceId)] = append(table[strings.ToLower(*inst.InstanceId)], record)
-
-						// register name
-						for _, tag := range inst.Tags {
-							if *tag.Key == "Name" {
-								table[strings.ToLower(*tag.Value)] = append(table[strings.ToLower(*tag.Value)], record)
-							}
-						}
-					}
-				}
+	// get sources of every providers
+	var jobs []*fetchJob
+	renewed := make(map[string]bool)
+	expiredAt := make(map[string]time.Time)
+	failedProviders := make(map[string]error)
+	for _, provider := range providers {
+		// answers never outlive a next refresh
+		refresh, ttl := s.schedule(provider)
+		if refresh < ttl {
+			ttl = refresh
+		}
+		renewed[provider.Name()] = true
+		expiredAt[provider.Name()] = now.Add(ttl)
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		sources, err := provider.Sources(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("[err] renewal %s %+v\n", provider.Name(), err)
+			failedProviders[provider.Name()] = err
+			continue
+		}
+		for _, source := range sources {
+			jobs = append(jobs, &fetchJob{provider: provider.Name(), name: provider.Name() + "/" + source.Name(), source: source})
+		}
+	}
+
+	// fetch sources in parallel, slow sources don't hold back others.
+	wg := &sync.WaitGroup{}
+	for _, job := range jobs {
+		wg.Add(1)
+		s.fetching <- struct{}{}
+		go func(job *fetchJob) {
+			defer func() {
+				<-s.fetching
+				wg.Done()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			defer cancel()
+			job.entries, job.err = job.source.Fetch(ctx)
+		}(job)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	succeeded, failed := 0, 0
+	for _, provider := range providers {
+		delete(s.failed, provider.Name())
+	}
+	for name, err := range failedProviders {
+		s.failed[name] = err
+		// keep last-known records of every sources of a provider
+		failed += 1
+		for sourceName, state := range s.states {
+			if state.provider == name {
+				seen[sourceName] = true
+				state.fail(err)
 			}
 		}
 	}
 
-	// gcp renewal
-	if s.gcpconf != nil {
-		for _, zone := range s.gcpconf.zones {
-			gcpListCall := s.gcpconf.client.Instances.List(s.gcpconf.projectId, zone)
-			gcpListCall.Filter("status = RUNNING")
-			instances, err := gcpListCall.Do()
-			if err != nil {
-				return err
+	for _, job := range jobs {
+		seen[job.name] = true
+		state, ok := s.states[job.name]
+		if !ok {
+			state = &sourceState{provider: job.provider}
+			s.states[job.name] = state
+		}
+
+		if job.err != nil {
+			log.Printf("[err] renewal %s %+v\n", job.name, job.err)
+			failed += 1
+			state.fail(job.err)
+			continue
+		}
+		succeeded += 1
+		for _, entry := range job.entries {
+			entry.Record.ExpiredAt = expiredAt[job.provider]
+			entry.Record.UpdatedAt = now
+			entry.Record.minTTL = s.minTTL
+		}
+		state.entries = job.entries
+		state.updatedAt = now
+		state.err = nil
+	}
+
+	// sources below a failed source(ex: regions of a failed account) keep last-known records
+	for _, job := range jobs {
+		if job.err == nil {
+			continue
+		}
+		for name, state := range s.states {
+			if !seen[name] && covers(job.name, name) {
+				seen[name] = true
+				state.fail(job.err)
 			}
-			for _, instance := range instances.Items {
-				if len(instance.NetworkInterfaces) > 0 {
-					record := &Record{Vendor: GCP, ExpiredAt: now.Add(TTL), ZoneOrRegion: zone}
-					// insert public ip
-					if len(instance.NetworkInterfaces[0].AccessConfigs) > 0 {
-						if value := net.ParseIP(instance.NetworkInterfaces[0].AccessConfigs[0].NatIP); value != nil {
-							record.PublicIP = value
-						}
-					}
-					// insert private ip
-					if value := net.ParseIP(instance.NetworkInterfaces[0].NetworkIP); value != nil {
-						record.PrivateIP = value
-					}
+		}
+	}
 
-					count += 1
-					// register instance-id
-					table[strconv.FormatInt(int64(instance.Id), 10)] = append(table[strconv.FormatInt(int64(instance.Id), 10)], record)
+	// drop disappeared sources
+	for name, state := range s.states {
+		if renewed[state.provider] && !seen[name] {
+			delete(s.states, name)
+		}
+	}
 
-					// register name
-					table[strings.ToLower(instance.Name)] = append(table[strings.ToLower(instance.Name)], record)
-				}
+	// failed sources without last-known records are served from a snapshot
+	restored := 0
+	if failed > 0 && s.snapshot != "" {
+		n, err := s.restore()
+		if err != nil {
+			log.Printf("[err] snapshot %+v\n", err)
+		}
+		restored = n
+	}
+
+	s.publish()
+	if failed > 0 {
+		log.Printf("%s[%d] sources serve last-known records\n", aurora.Red("[stale]"), failed)
+	}
+	for _, status := range s.status() {
+		if status.Stale {
+			log.Printf("%s %s records(%d) updated(%s) %v\n", aurora.Red("[status]"), status.Name, status.Records, status.UpdatedAt.String(), status.Err)
+		}
+	}
+	if succeeded > 0 && s.snapshot != "" {
+		if err := writeSnapshot(s.snapshot, s.states); err != nil {
+			log.Printf("[err] snapshot %+v\n", err)
+		}
+	}
+	if succeeded == 0 && restored == 0 && failed > 0 {
+		return fmt.Errorf("[err] renewal every %d sources failed", failed)
+	}
+	return nil
+}
+
+// publish merges entries of every sources into a lookup table, a caller must hold a lock.
+func (s *Store) publish() {
+	var entries []*Entry
+	for _, state := range s.states {
+		entries = append(entries, state.entries...)
+	}
+	table := merge(entries)
+	s.cache.Store(ReverseCacheName, reverseIndex(entries))
+	s.cache.Store(ParentCacheName, parents(table))
+	s.cache.Store(CacheName, table)
+	s.cacheUpdatedAt = time.Now()
+	log.Printf("%s[%d] cache table %s\n", aurora.Yellow("[update]"), len(entries), time.Now().String())
+
+	// different raw names normalized to a name are logged once
+	found := collisions(entries)
+	for name, raws := range found {
+		if !s.collisions[name] {
+			log.Printf("%s %s <- %s\n", aurora.Red("[collision]"), name, strings.Join(raws, ", "))
+		}
+	}
+	s.collisions = make(map[string]bool, len(found))
+	for name := range found {
+		s.collisions[name] = true
+	}
+}
+
+// restore serves a snapshot as stale for failed sources having no records, a caller must hold a lock.
+// a source of a provider failed to list sources is restored when it doesn't exist yet.
+func (s *Store) restore() (int, error) {
+	cause := func(name, provider string) error {
+		if state, ok := s.states[name]; ok {
+			if len(state.entries) > 0 {
+				return nil
 			}
+			return state.err
+		}
+		for parent, state := range s.states {
+			if state.err != nil && covers(parent, name) {
+				return state.err
+			}
+		}
+		return s.failed[provider]
+	}
+
+	// a snapshot is read only when there are sources to restore
+	empty := false
+	for name, state := range s.states {
+		if cause(name, state.provider) != nil {
+			empty = true
+		}
+	}
+	if !empty && len(s.failed) == 0 {
+		return 0, nil
+	}
+
+	snap, err := readSnapshot(s.snapshot)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	restored := 0
+	for name, source := range snap.Sources {
+		err := cause(name, source.Provider)
+		if err == nil || len(source.Entries) == 0 {
+			continue
+		}
+		for _, entry := range source.Entries {
+			// restored records are answered with a minimum ttl until a renewal is success.
+			entry.Record.Stale = true
+			entry.Record.ExpiredAt = now
+			entry.Record.minTTL = s.minTTL
+		}
+		s.states[name] = &sourceState{provider: source.Provider, entries: source.Entries, updatedAt: source.UpdatedAt, err: err}
+		restored += 1
+	}
+	if restored > 0 {
+		log.Printf("%s[%d] sources restored from %s written at %s\n", aurora.Red("[snapshot]"), restored, s.snapshot, snap.UpdatedAt.String())
+	}
+	return restored, nil
+}
+
+// Status returns refresh states of every sources.
+func (s *Store) Status() []*SourceStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status()
+}
+
+// UpdatedAt returns a time a lookup table is published.
+func (s *Store) UpdatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cacheUpdatedAt
+}
+
+// status returns refresh states of every sources, a caller must hold a lock.
+func (s *Store) status() []*SourceStatus {
+	var statuses []*SourceStatus
+	for name, state := range s.states {
+		statuses = append(statuses, &SourceStatus{
+			Name:      name,
+			Records:   len(state.entries),
+			UpdatedAt: state.updatedAt,
+			Stale:     state.err != nil,
+			Err:       state.err,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// fail keeps last-known entries as stale copies.
+func (s *sourceState) fail(err error) {
+	if s.err == nil {
+		stale := make([]*Entry, 0, len(s.entries))
+		for _, entry := range s.entries {
+			record := *entry.Record
+			record.Stale = true
+			stale = append(stale, &Entry{Record: &record, Names: entry.Names, Origins: entry.Origins})
+		}
+		s.entries = stale
+	}
+	s.err = err
+}
+
+// covers checks a source is below a parent source(ex: AWS/prod covers AWS/prod/us-east-1).
+// a parent of an empty name(ex: AWS/ of a default account) covers every sources of a provider.
+func covers(parent, name string) bool {
+	return name != parent && strings.HasPrefix(name, strings.TrimSuffix(parent, "/")+"/")
+}
+
+// merge builds a lookup table indexing every record under its names.
+func merge(entries []*Entry) LookupTable {
+	table := make(LookupTable)
+	for _, entry := range entries {
+		for _, name := range entry.Names {
+			if name == "" {
+				continue
+			}
+			key := strings.ToLower(name)
+			table[key] = append(table[key], entry.Record)
 		}
 	}
 
@@ -152,44 +466,95 @@ func (s *Store) renewal() error {
 			return crc32.ChecksumIEEE(v[i].PublicIP) < crc32.ChecksumIEEE(v[j].PublicIP)
 		})
 	}
+	return table
+}
 
-	s.cache.Store(CacheName, table)
-	s.cacheUpdatedAt = time.Now()
-	log.Printf("%s[%d] cache table %s\n", aurora.Yellow("[update]"), count, time.Now().String())
-	return nil
+// parents returns names having indexed names below them(ex: web.role.tag -> role.tag, tag).
+func parents(table LookupTable) map[string]bool {
+	found := make(map[string]bool)
+	for key := range table {
+		for ix := strings.Index(key, "."); ix != -1; ix = strings.Index(key, ".") {
+			key = key[ix+1:]
+			if found[key] {
+				break
+			}
+			found[key] = true
+		}
+	}
+	return found
 }
 
 func (r *Record) TTL() time.Duration {
 	now := time.Now()
 	duration := r.ExpiredAt.Sub(now)
-	if duration < 0 {
-		return 5 * time.Second
+	minTTL := r.minTTL
+	if minTTL <= 0 {
+		minTTL = defaultMinTTL
+	}
+	if duration < minTTL {
+		return minTTL
 	}
 	return duration
 }
 
-func NewStore(awsconf *AwsConfig, gcpconf *GcpConfig) (*Store, error) {
+func NewStore(config *CommonConfig, providers ...InstanceProvider) (*Store, error) {
 	store := &Store{}
 	store.cache = &sync.Map{}
-	store.awsconf = awsconf
-	store.gcpconf = gcpconf
+	store.providers = providers
+	store.states = make(map[string]*sourceState)
+	store.failed = make(map[string]error)
+	concurrency := defaultConcurrency
+	store.timeout = defaultTimeout
+	store.refresh = defaultRefreshInterval
+	store.ttl = TTL
+	store.minTTL = defaultMinTTL
+	store.staleMaxAge = defaultStaleMaxAge
+	store.staleAction = staleActionDrop
+	if config != nil {
+		if config.concurrency > 0 {
+			concurrency = config.concurrency
+		}
+		if config.timeout > 0 {
+			store.timeout = config.timeout
+		}
+		if config.refreshInterval > 0 {
+			store.refresh = config.refreshInterval
+		}
+		if config.ttl > 0 {
+			store.ttl = config.ttl
+		}
+		if config.minTTL > 0 {
+			store.minTTL = config.minTTL
+		}
+		store.snapshot = config.snapshot
+		if config.staleMaxAge > 0 {
+			store.staleMaxAge = config.staleMaxAge
+		}
+		if config.staleAction != "" {
+			store.staleAction = config.staleAction
+		}
+	}
+	store.fetching = make(chan struct{}, concurrency)
 
-	// a first renewal must be success
+	// a first renewal must be success, or a snapshot is served until a next renewal is success.
 	if err := store.renewal(); err != nil {
 		return nil, err
 	}
 
-	// periodic renewal
-	go func() {
-		tick := time.NewTicker(1 * time.Minute)
-		for {
-			select {
-			case <-tick.C:
-				if err := store.renewal(); err != nil {
-					log.Printf("[err] renewal %+v\n", err)
+	// periodic renewal per provider
+	for _, provider := range providers {
+		refresh, _ := store.schedule(provider)
+		go func(provider InstanceProvider, refresh time.Duration) {
+			tick := time.NewTicker(refresh)
+			for {
+				select {
+				case <-tick.C:
+					if err := store.renew([]InstanceProvider{provider}); err != nil {
+						log.Printf("[err] renewal %+v\n", err)
+					}
 				}
 			}
-		}
-	}()
+		}(provider, refresh)
+	}
 	return store, nil
 }
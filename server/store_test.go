@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
@@ -23,7 +24,7 @@ func TestNewStore(t *testing.T) {
 		_, awsconfig, gcpconfig, err := ParseConfig(config)
 		assert.NoError(err)
 
-		store, err := NewStore(awsconfig, gcpconfig)
+		store, err := NewStore(nil, NewProviders(awsconfig, gcpconfig)...)
 		assert.NoError(err)
 		_ = store
 	}
@@ -43,7 +44,7 @@ func TestStore_Lookup(t *testing.T) {
 		_, awsconfig, gcpconfig, err := ParseConfig(config)
 		assert.NoError(err)
 
-		store, err := NewStore(awsconfig, gcpconfig)
+		store, err := NewStore(nil, NewProviders(awsconfig, gcpconfig)...)
 		assert.NoError(err)
 
 		// empty
@@ -76,6 +77,52 @@ func TestStore_Lookup(t *testing.T) {
 
 }
 
+func TestStore_LookupStale(t *testing.T) {
+	assert := assert.New(t)
+
+	gcp := &fakeProvider{name: string(GCP), entries: []*Entry{
+		{Record: &Record{Vendor: GCP}, Names: []string{"web", "db"}},
+	}}
+	aws := &fakeProvider{name: string(AWS), entries: []*Entry{
+		{Record: &Record{Vendor: AWS}, Names: []string{"web"}},
+	}}
+
+	tests := map[string]struct {
+		action string
+		err    error
+	}{
+		"drop":     {action: staleActionDrop, err: ErrStaleDropped},
+		"servfail": {action: staleActionServfail, err: ErrStaleExpired},
+	}
+	for _, t := range tests {
+		gcp.err = nil
+		store, err := NewStore(&CommonConfig{staleMaxAge: time.Hour, staleAction: t.action}, aws, gcp)
+		assert.NoError(err)
+
+		// stale records are answered within a max age
+		gcp.err = fmt.Errorf("[err] fake")
+		assert.NoError(store.renewal())
+		records, err := store.Lookup("db")
+		assert.NoError(err)
+		assert.Len(records, 1)
+		assert.True(records[0].Stale)
+
+		// stale records are dropped after a max age
+		for _, state := range store.states {
+			for _, entry := range state.entries {
+				entry.Record.UpdatedAt = entry.Record.UpdatedAt.Add(-2 * time.Hour)
+			}
+		}
+		records, err = store.Lookup("web")
+		assert.NoError(err)
+		assert.Len(records, 1)
+		assert.Equal(AWS, records[0].Vendor)
+		records, err = store.Lookup("db")
+		assert.Equal(t.err, err)
+		assert.Len(records, 0)
+	}
+}
+
 func TestRecord_TTL(t *testing.T) {
 	assert := assert.New(t)
 
@@ -89,7 +136,7 @@ func TestRecord_TTL(t *testing.T) {
 		_, awsconfig, gcpconfig, err := ParseConfig(config)
 		assert.NoError(err)
 
-		store, err := NewStore(awsconfig, gcpconfig)
+		store, err := NewStore(nil, NewProviders(awsconfig, gcpconfig)...)
 		assert.NoError(err)
 
 		table, ok := store.cache.Load(CacheName)
@@ -110,9 +157,26 @@ func BenchmarkStore_Lookup(b *testing.B) {
 		bys, _ := ioutil.ReadFile(yamlPath)
 		yaml.Unmarshal(bys, &config)
 		_, awsconfig, gcpconfig, _ := ParseConfig(config)
-		store, _ := NewStore(awsconfig, gcpconfig)
+		store, _ := NewStore(nil, NewProviders(awsconfig, gcpconfig)...)
 		for i := 0; i < b.N; i++ {
 			store.Lookup(os.Getenv("TEST_AWS_1"))
 		}
 	}
 }
+
+func TestParents(t *testing.T) {
+	assert := assert.New(t)
+
+	found := parents(LookupTable{"web": nil, "web.prod": nil, "frontend.role.tag": nil, "backend.role.tag": nil})
+	assert.Equal(map[string]bool{"prod": true, "role.tag": true, "tag": true}, found)
+}
+
+func TestCovers(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(covers("AWS/prod", "AWS/prod/us-east-1"))
+	assert.False(covers("AWS/prod", "AWS/prod"))
+	assert.False(covers("AWS/prod", "AWS/production/us-east-1"))
+	assert.True(covers("AWS/", "AWS/us-east-1"))
+	assert.False(covers("AWS/", "GCP/project/zone"))
+}